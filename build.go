@@ -1,53 +1,418 @@
+//go:build ignore
+
+// build.go - tunnel client va server release'ini yig'ish:
+//
+//	go run build.go -version v1.2.0 -parallel
+//
+// Natija builds/ papkasida: har bir platforma uchun binarlar, archives/ da
+// arxivlar, SHA256SUMS va manifest.json ("mytunnel update" uchun; imzo kaliti
+// berilsa manifest.json.sig ham).
 package main
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-tunnel/release"
 )
 
 type Target struct {
 	os   string
 	arch string
-	path string
+	dir  string // builds/ ichidagi papka
+	name string // fayl nomidagi platforma: mytunnel-<name>
 }
 
-func submain() {
+func (t Target) ext() string {
+	if t.os == "windows" {
+		return ".exe"
+	}
+	return ""
+}
+
+// binary - program (client/server) uchun builds/ ga nisbatan yo'l
+func (t Target) binary(program string) string {
+	prefix := "mytunnel-"
+	if program == "server" {
+		prefix = "mytunnel-server-"
+	}
+	return filepath.ToSlash(filepath.Join(t.dir, prefix+t.name+t.ext()))
+}
+
+// programs - yig'iladigan dasturlar va ularning paketlari
+var programs = []struct{ name, pkg string }{
+	{"client", "./client"},
+	{"server", "./server"},
+}
+
+// buildInfo - binarlarga -ldflags orqali yoziladigan ma'lumot
+type buildInfo struct {
+	version   string
+	commit    string
+	date      string
+	updateKey string // client uchun release imzosini tekshiradigan public key
+}
+
+func main() {
 	osFlag := flag.String("os", "all", "Build uchun operatsion tizim (windows, linux, mac, all)")
+	version := flag.String("version", "", "Release versiyasi (standart: git describe)")
+	out := flag.String("out", "builds", "Natija papkasi")
+	parallel := flag.Bool("parallel", false, "Platformalarni parallel yig'ish")
+	jobs := flag.Int("jobs", runtime.NumCPU(), "-parallel da bir vaqtda ishlaydigan build'lar soni")
+	archive := flag.Bool("archive", true, "Har bir platforma uchun arxiv (tar.gz/zip) yaratish")
+	signKey := flag.String("sign-key", os.Getenv("RELEASE_SIGNING_KEY"), "manifest.json ni imzolash uchun ed25519 private key (base64) yoki fayl")
+	genKey := flag.Bool("genkey", false, "Yangi imzo kalitlari juftligini chiqarish va tugatish")
 	flag.Parse()
 
+	if *genKey {
+		generateKey()
+		return
+	}
+
 	targets := []Target{
-		{"windows", "amd64", "builds/win/64/mytunnel-win64.exe"},
-		{"windows", "386",   "builds/win/32/mytunnel-win32.exe"},
-		{"linux",   "amd64", "builds/linux/64/mytunnel-linux-amd64"},
-		{"linux",   "386",   "builds/linux/32/mytunnel-linux-386"},
-		{"linux",   "arm",   "builds/linux/arm/mytunnel-linux-arm"},
-		{"darwin",  "amd64", "builds/mac/intel/mytunnel-macos-intel"},
-		{"darwin",  "arm64", "builds/mac/arm/mytunnel-macos-arm"},
+		{"windows", "amd64", "win/64", "win64"},
+		{"windows", "386", "win/32", "win32"},
+		{"linux", "amd64", "linux/64", "linux-amd64"},
+		{"linux", "386", "linux/32", "linux-386"},
+		{"linux", "arm", "linux/arm", "linux-arm"},
+		{"darwin", "amd64", "mac/intel", "macos-intel"},
+		{"darwin", "arm64", "mac/arm", "macos-arm"},
 	}
 
+	var selected []Target
 	for _, t := range targets {
 		if *osFlag != "all" && *osFlag != t.os && !(*osFlag == "mac" && t.os == "darwin") {
 			continue
 		}
-		dir := filepath.Dir(t.path)
-		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-			fmt.Printf("Papka yaratishda xato (%s): %v\n", dir, err)
-			continue
+		selected = append(selected, t)
+	}
+
+	info := gitInfo(*version)
+	var key ed25519.PrivateKey
+	if *signKey != "" {
+		var err error
+		if key, err = loadSigningKey(*signKey); err != nil {
+			fmt.Printf("Imzo kaliti xatosi: %v\n", err)
+			os.Exit(1)
+		}
+		info.updateKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	}
+	fmt.Printf("Release %s (commit %s, %s)\n", info.version, info.commit, info.date)
+
+	workers := 1
+	if *parallel {
+		workers = *jobs
+	}
+	if !buildAll(selected, *out, info, workers) {
+		fmt.Println("\nBuild muvaffaqiyatsiz: manifest yaratilmadi.")
+		os.Exit(1)
+	}
+
+	manifest, err := writeRelease(selected, *out, info, *archive)
+	if err != nil {
+		fmt.Printf("Release xatosi: %v\n", err)
+		os.Exit(1)
+	}
+	if key != nil {
+		if err := os.WriteFile(filepath.Join(*out, "manifest.json.sig"), release.Sign(manifest, key), 0o644); err != nil {
+			fmt.Printf("Imzo xatosi: %v\n", err)
+			os.Exit(1)
 		}
+	} else {
+		fmt.Println("OGOHLANTIRISH: -sign-key berilmagan, manifest imzolanmadi ('mytunnel update' uni qabul qilmaydi)")
+	}
+	fmt.Printf("\nBuild jarayoni yakunlandi. Fayllar '%s/' papkasida.\n", *out)
+}
+
+// buildAll har bir platforma va dastur uchun go build ishlatadi
+func buildAll(targets []Target, out string, info buildInfo, workers int) bool {
+	type job struct {
+		target  Target
+		program string
+		pkg     string
+	}
+	jobs := make(chan job)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ok := true
 
-		fmt.Printf("Building for %s (%s) -> %s\n", t.os, t.arch, t.path)
-		
-		cmd := exec.Command("go", "build", "-o", t.path, "client/client.go")
-		cmd.Env = append(os.Environ(), "GOOS="+t.os, "GOARCH="+t.arch)
-		
-		cmd.Stderr = os.Stderr
-		
-		if err := cmd.Run(); err != nil {
-			fmt.Printf("Xatolik [%s/%s]: %v\n", t.os, t.arch, err)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := build(j.target, j.program, j.pkg, out, info); err != nil {
+					mu.Lock()
+					ok = false
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, t := range targets {
+		for _, p := range programs {
+			jobs <- job{t, p.name, p.pkg}
 		}
 	}
-	fmt.Println("\nBuild jarayoni yakunlandi. Fayllar 'builds/' papkasida.")
-}
\ No newline at end of file
+	close(jobs)
+	wg.Wait()
+	return ok
+}
+
+func build(t Target, program, pkg, out string, info buildInfo) error {
+	path := filepath.Join(out, t.binary(program))
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		fmt.Printf("Papka yaratishda xato (%s): %v\n", filepath.Dir(path), err)
+		return err
+	}
+
+	ldflags := []string{
+		"-s", "-w",
+		"-X", "main.version=" + info.version,
+		"-X", "main.commit=" + info.commit,
+		"-X", "main.date=" + info.date,
+	}
+	if program == "client" && info.updateKey != "" {
+		ldflags = append(ldflags, "-X", "main.updateKey="+info.updateKey)
+	}
+
+	fmt.Printf("Building %s for %s (%s) -> %s\n", program, t.os, t.arch, path)
+
+	// -trimpath va -buildvcs=false: bir xil commit'dan bir xil binar chiqadi
+	cmd := exec.Command("go", "build", "-trimpath", "-buildvcs=false", "-ldflags", strings.Join(ldflags, " "), "-o", path, pkg)
+	cmd.Env = append(os.Environ(), "GOOS="+t.os, "GOARCH="+t.arch, "CGO_ENABLED=0")
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		fmt.Printf("Xatolik [%s %s/%s]: %v\n%s", program, t.os, t.arch, err, output)
+	}
+	return err
+}
+
+// writeRelease arxivlar, SHA256SUMS va manifest.json ni yozadi; manifest
+// baytlarini (imzolash uchun) qaytaradi
+func writeRelease(targets []Target, out string, info buildInfo, withArchives bool) ([]byte, error) {
+	modTime, err := time.Parse(time.RFC3339, info.date)
+	if err != nil {
+		modTime = time.Unix(0, 0)
+	}
+
+	manifest := release.Manifest{Version: info.version, Commit: info.commit, Date: info.date}
+	sums := map[string]string{}
+
+	for _, t := range targets {
+		var archivePath, archiveSum string
+		if withArchives {
+			archivePath = filepath.ToSlash(filepath.Join("archives", fmt.Sprintf("mytunnel-%s-%s-%s", info.version, t.os, t.arch)))
+			if t.os == "windows" {
+				archivePath += ".zip"
+			} else {
+				archivePath += ".tar.gz"
+			}
+			if err := writeArchive(filepath.Join(out, archivePath), out, t, modTime); err != nil {
+				return nil, err
+			}
+			if archiveSum, _, err = fileSum(filepath.Join(out, archivePath)); err != nil {
+				return nil, err
+			}
+			sums[archivePath] = archiveSum
+		}
+
+		for _, p := range programs {
+			file := t.binary(p.name)
+			sum, size, err := fileSum(filepath.Join(out, file))
+			if err != nil {
+				return nil, err
+			}
+			sums[file] = sum
+			manifest.Artifacts = append(manifest.Artifacts, release.Artifact{
+				Name:          p.name,
+				OS:            t.os,
+				Arch:          t.arch,
+				File:          file,
+				SHA256:        sum,
+				Size:          size,
+				Archive:       archivePath,
+				ArchiveSHA256: archiveSum,
+			})
+		}
+	}
+
+	// SHA256SUMS - "sha256sum -c SHA256SUMS" bilan tekshiriladi
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var lines strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&lines, "%s  %s\n", sums[name], name)
+	}
+	if err := os.WriteFile(filepath.Join(out, "SHA256SUMS"), []byte(lines.String()), 0o644); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	data = append(data, '\n')
+	return data, os.WriteFile(filepath.Join(out, "manifest.json"), data, 0o644)
+}
+
+// writeArchive platformaning client va server binarlarini bitta arxivga
+// joylaydi; vaqt va egalar qat'iy, shuning uchun arxiv ham takrorlanuvchan
+func writeArchive(path, out string, t Target, modTime time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if t.os == "windows" {
+		zw := zip.NewWriter(f)
+		for _, p := range programs {
+			file := filepath.Join(out, t.binary(p.name))
+			header := &zip.FileHeader{Name: filepath.Base(file), Method: zip.Deflate, Modified: modTime}
+			header.SetMode(0o755)
+			w, err := zw.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			if err := copyFile(w, file); err != nil {
+				return err
+			}
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		return f.Close()
+	}
+
+	gz, err := gzip.NewWriterLevel(f, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(gz)
+	for _, p := range programs {
+		file := filepath.Join(out, t.binary(p.name))
+		stat, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Name:    filepath.Base(file),
+			Mode:    0o755,
+			Size:    stat.Size(),
+			ModTime: modTime,
+			Format:  tar.FormatPAX,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if err := copyFile(tw, file); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func fileSum(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	n, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), n, nil
+}
+
+// gitInfo versiya, commit va sanani git'dan oladi. Sana - commit vaqti,
+// hozirgi vaqt emas, shuning uchun qayta yig'ilgan binar o'zgarmaydi.
+func gitInfo(version string) buildInfo {
+	info := buildInfo{version: version, commit: "unknown", date: "1970-01-01T00:00:00Z"}
+	if info.version == "" {
+		info.version = git("describe", "--tags", "--always", "--dirty")
+		if info.version == "" {
+			info.version = "dev"
+		}
+	}
+	if commit := git("rev-parse", "--short", "HEAD"); commit != "" {
+		info.commit = commit
+	}
+	if date := git("log", "-1", "--format=%cI"); date != "" {
+		if t, err := time.Parse(time.RFC3339, date); err == nil {
+			info.date = t.UTC().Format(time.RFC3339)
+		}
+	}
+	return info
+}
+
+func git(args ...string) string {
+	output, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// loadSigningKey kalitni to'g'ridan-to'g'ri (base64) yoki fayldan o'qiydi
+func loadSigningKey(value string) (ed25519.PrivateKey, error) {
+	if data, err := os.ReadFile(value); err == nil {
+		value = string(data)
+	}
+	return release.ParsePrivateKey(value)
+}
+
+func generateKey() {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		fmt.Printf("Kalit yaratishda xato: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("RELEASE_SIGNING_KEY=%s\n", base64.StdEncoding.EncodeToString(private.Seed()))
+	fmt.Printf("MYTUNNEL_UPDATE_KEY=%s\n", base64.StdEncoding.EncodeToString(public))
+	fmt.Println("\nPrivate key'ni maxfiy saqlang; public key build paytida clientga yoziladi.")
+}
@@ -3,93 +3,300 @@ package main
 import (
 	"flag"
 	"fmt"
-	"io"
 	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
 	"time"
-	"sync/atomic"
+
+	"go-tunnel/tunnel"
+)
+
+// build.go -ldflags orqali beriladi
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
 )
 
-var requestID int64
+const usage = `Foydalanish:
+  mytunnel http [flaglar] <port>      HTTP tunnel (Host, rewrite, siqish HTTP darajasida)
+  mytunnel tcp [flaglar] <port>       Xom TCP tunnel
+  mytunnel start [-config fayl] <nom>... | -all
+                                      Config fayldagi tunnellarni ishga tushirish
+  mytunnel status                     Ishlab turgan tunnellar holati
+  mytunnel stop [nom]                 Tunnelni (yoki butun clientni) to'xtatish
+  mytunnel update [-check]            Imzolangan release dan yangilash
+  mytunnel version                    Client va protokol versiyasi
+  mytunnel [flaglar]                  Eski rejim: -local portdagi bitta tunnel
+
+Client ishlab turgan bo'lsa http/tcp/start yangi tunnelni shu clientga qo'shadi.
+Batafsil: mytunnel <buyruq> -h
+`
 
 func main() {
-	serverAddr := flag.String("server", "192.168.122.91:9000", "Server IP va port")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "http", "tcp":
+			runProtoCommand(os.Args[1], os.Args[2:])
+			return
+		case "start":
+			runStartCommand(os.Args[2:])
+			return
+		case "status":
+			runStatusCommand(os.Args[2:])
+			return
+		case "stop":
+			runStopCommand(os.Args[2:])
+			return
+		case "update":
+			runUpdateCommand(os.Args[2:])
+			return
+		case "version":
+			fmt.Printf("mytunnel %s (protokol v%d)\n", version, tunnel.ProtocolVersion)
+			if commit != "" {
+				fmt.Printf("commit %s, %s\n", commit, date)
+			}
+			return
+		case "help":
+			fmt.Print(usage)
+			return
+		}
+	}
+	runLegacy()
+}
+
+// runLegacy - subcommand siz eski ishga tushirish: mytunnel -local 8000 -name alice
+func runLegacy() {
+	config := &tunnelConfig{Proto: "tcp"}
+	registerTunnelFlags(flag.CommandLine, config)
 	localPort := flag.Int("local", 8000, "Laravel porti")
+	control := flag.String("control", "", "Control socket manzili (standart: "+defaultControlAddr+")")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage+"\nEski rejim flaglari:\n")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
+	config.Local = strconv.Itoa(*localPort)
 
-	localAddr := fmt.Sprintf("localhost:%d", *localPort)
+	runTunnels(controlAddr(*control), []*tunnelConfig{config}, false)
+}
 
-	fmt.Println("============================================")
-	fmt.Printf("TUNNEL CLIENT: %s -> %s\n", *serverAddr, localAddr)
-	fmt.Println("Monitoring yoqildi. Har bir so'rov shu yerda ko'rinadi.")
-	fmt.Println("============================================")
+// runProtoCommand - mytunnel http 8000 / mytunnel tcp 5432
+func runProtoCommand(proto string, args []string) {
+	fs := flag.NewFlagSet(proto, flag.ExitOnError)
+	config := &tunnelConfig{Proto: proto}
+	registerTunnelFlags(fs, config)
+	fs.StringVar(&config.Name, "label", "", "Client ichidagi tunnel nomi (status/stop uchun, standart: -name yoki proto-port)")
+	control := fs.String("control", "", "Control socket manzili (standart: "+defaultControlAddr+")")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Foydalanish: mytunnel %s [flaglar] <port yoki host:port>\n", proto)
+		fs.PrintDefaults()
+	}
 
-	// Tunnel pool (zaxira ulanishlar)
-	for i := 0; i < 25; i++ {
-		go createTunnelWorker(*serverAddr, localAddr)
+	positional := parseInterspersed(fs, args)
+	if len(positional) != 1 {
+		fs.Usage()
+		os.Exit(2)
 	}
+	config.Local = positional[0]
 
-	select {}
+	runTunnels(controlAddr(*control), []*tunnelConfig{config}, true)
 }
 
-func createTunnelWorker(server, local string) {
-	for {
-		tunnel, err := net.Dial("tcp", server)
-		if err != nil {
-			time.Sleep(3 * time.Second)
-			continue
-		}
+// runStartCommand - config fayldagi nomlangan tunnellar
+func runStartCommand(args []string) {
+	fs := flag.NewFlagSet("start", flag.ExitOnError)
+	configPath := fs.String("config", "", "Config fayl (standart: ./mytunnel.json yoki ~/.mytunnel.json)")
+	all := fs.Bool("all", false, "Config dagi barcha tunnellarni ishga tushirish")
+	control := fs.String("control", "", "Control socket manzili (standart: "+defaultControlAddr+")")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Foydalanish: mytunnel start [-config fayl] <nom>... | -all")
+		fs.PrintDefaults()
+	}
+	names := parseInterspersed(fs, args)
 
-		// Serverdan birinchi bayt kelishini kutamiz (Request boshlanishi)
-		buf := make([]byte, 1024)
-		n, err := tunnel.Read(buf)
-		if err != nil {
-			tunnel.Close()
-			continue
-		}
+	path := *configPath
+	if path == "" {
+		path = defaultConfigPath()
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		fmt.Printf("XATO: config: %v\n", err)
+		os.Exit(1)
+	}
+	tunnels, err := config.selectTunnels(names, *all)
+	if err != nil {
+		fmt.Printf("XATO: %v\n", err)
+		os.Exit(1)
+	}
 
-		id := atomic.AddInt64(&requestID, 1)
-		fmt.Printf("[Conn #%d] Tunnel ishga tushdi. Clientga yo'naltirilmoqda...\n", id)
+	addr := *control
+	if addr == "" {
+		addr = config.Control
+	}
+	runTunnels(controlAddr(addr), tunnels, true)
+}
 
-		localConn, err := net.Dial("tcp", local)
-		if err != nil {
-			fmt.Printf("[Conn #%d] XATO: Clientga ulanib bo'lmadi: %v\n", id, err)
-			tunnel.Close()
-			continue
+// runStatusCommand ishlab turgan client tunnellarini chiqaradi
+func runStatusCommand(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	control := fs.String("control", "", "Control socket manzili (standart: "+defaultControlAddr+")")
+	fs.Parse(args)
+
+	var statuses []TunnelStatus
+	if _, err := callControl(controlAddr(*control), ControlRequest{Method: "STATUS"}, &statuses); err != nil {
+		fmt.Printf("XATO: %v\n", err)
+		os.Exit(1)
+	}
+	if len(statuses) == 0 {
+		fmt.Println("Ishlab turgan tunnellar yo'q")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NOM\tPROTO\tPUBLIC URL\tLOKAL\tSERVER\tZAXIRA\tFAOL\tJAMI\tVAQT\tXATO")
+	for _, s := range statuses {
+		publicURL := "-"
+		if s.Registration != nil && len(s.Registration.URLs) > 0 {
+			publicURL = strings.Join(s.Registration.URLs, ",")
 		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n", s.Name, s.Proto, publicURL, s.Local, s.Server,
+			s.Connected, s.Active, s.Connections, time.Since(s.StartedAt).Round(time.Second), s.Error)
+	}
+	w.Flush()
+}
 
-		// Birinchi olingan paketni yuborish
-		localConn.Write(buf[:n])
+// runStopCommand bitta tunnelni yoki butun clientni to'xtatadi
+func runStopCommand(args []string) {
+	fs := flag.NewFlagSet("stop", flag.ExitOnError)
+	control := fs.String("control", "", "Control socket manzili (standart: "+defaultControlAddr+")")
+	fs.Parse(args)
 
-		// Ma'lumot almashinuvi
-		handle(id, tunnel, localConn)
+	req := ControlRequest{Method: "STOP"}
+	if fs.NArg() > 0 {
+		req = ControlRequest{Method: "REMOVE", Name: fs.Arg(0)}
+	}
+	response, err := callControl(controlAddr(*control), req, nil)
+	if err != nil {
+		fmt.Printf("XATO: %v\n", err)
+		os.Exit(1)
 	}
+	fmt.Println(response.Message)
 }
 
-func handle(id int64, tunnel, local net.Conn) {
-	defer tunnel.Close()
-	defer local.Close()
+// runTunnels tunnellarni ishga tushiradi. delegate bo'lsa va client allaqachon
+// ishlayotgan bo'lsa, tunnellar o'sha clientga control socket orqali qo'shiladi.
+func runTunnels(control string, configs []*tunnelConfig, delegate bool) {
+	if delegate {
+		if _, err := callControl(control, ControlRequest{Method: "STATUS"}, nil); err == nil {
+			failed := false
+			for _, config := range configs {
+				// Fayl yo'llari ishlab turgan client jarayonining papkasiga nisbatan emas
+				config.URLFile = absPath(config.URLFile)
+				config.LocalCA = absPath(config.LocalCA)
 
-	done := make(chan struct{}, 2)
+				var status TunnelStatus
+				if _, err := callControl(control, ControlRequest{Method: "ADD", Name: config.Name, Tunnel: config}, &status); err != nil {
+					fmt.Printf("XATO: %v\n", err)
+					failed = true
+					continue
+				}
+				fmt.Printf("Tunnel ishlab turgan clientga qo'shildi: %s (%s)\n", status.Name, status.Local)
+				if registration := awaitRegistration(control, status.Name, 5*time.Second); registration != nil {
+					for _, url := range registration.URLs {
+						fmt.Printf("%s: %s\n", status.Name, url)
+					}
+				}
+			}
+			if failed {
+				os.Exit(1)
+			}
+			return
+		}
+	}
 
-	// Client -> Server (Laraveldan javobni Serverga)
-	go func() {
-		n, _ := io.Copy(tunnel, local)
-		if n > 0 {
-			fmt.Printf("[Conn #%d] Clientdan javob: %d bytes serverga ketdi\n", id, n)
+	fmt.Println("============================================")
+	tunnels := newManager()
+	for _, config := range configs {
+		if _, err := tunnels.add(config); err != nil {
+			fmt.Printf("XATO: %v\n", err)
+			os.Exit(1)
 		}
-		done <- struct{}{}
-	}()
+	}
 
-	// Server -> Client (Serverdan so'rovni Laravelga)
-	go func() {
-		n, _ := io.Copy(local, tunnel)
-		if n > 0 {
-			fmt.Printf("[Conn #%d] Serverdan so'rov: %d bytes Clientga keldi\n", id, n)
+	// Control socket: status/stop va boshqa terminaldan tunnel qo'shish
+	if listener, err := net.Listen("tcp", control); err == nil {
+		defer listener.Close()
+		if token, path, err := writeControlToken(control); err == nil {
+			defer os.Remove(path)
+			go serveControl(listener, token, tunnels, tunnels.stopAll)
+			fmt.Printf("Control socket: %s\n", control)
+		} else {
+			listener.Close()
+			fmt.Printf("OGOHLANTIRISH: control token yozilmadi, control socket yopildi (%v)\n", err)
 		}
-		done <- struct{}{}
+	} else {
+		fmt.Printf("OGOHLANTIRISH: control socket ochilmadi (%v)\n", err)
+	}
+	fmt.Println("Monitoring yoqildi. Har bir so'rov shu yerda ko'rinadi.")
+	fmt.Println("============================================")
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		fmt.Println("\nClient to'xtatilmoqda...")
+		tunnels.stopAll()
 	}()
 
-	<-done
-	fmt.Printf("[Conn #%d] Tugallandi.\n", id)
+	if !tunnels.wait() {
+		os.Exit(1)
+	}
+}
+
+// awaitRegistration ishlab turgan clientdan tunnelning public URL larini kutadi
+func awaitRegistration(control, name string, timeout time.Duration) *tunnel.Registration {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		var statuses []TunnelStatus
+		if _, err := callControl(control, ControlRequest{Method: "STATUS"}, &statuses); err != nil {
+			return nil
+		}
+		for _, status := range statuses {
+			if status.Name == name && status.Registration != nil {
+				return status.Registration
+			}
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return nil
+}
+
+func absPath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
 }
 
+// parseInterspersed flaglarni pozitsion argumentlardan keyin ham qabul qiladi:
+// mytunnel http 8000 -name alice
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
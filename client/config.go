@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	defaultServer  = "192.168.122.91:9000"
+	defaultWorkers = 25
+)
+
+// tunnelConfig - bitta tunnel sozlamalari (CLI flaglari yoki config fayldan)
+type tunnelConfig struct {
+	Name          string `json:"-"`                   // client ichidagi nom: status/stop uchun
+	Proto         string `json:"proto"`               // http yoki tcp
+	Server        string `json:"server,omitempty"`    // tunnel server control manzili
+	Local         string `json:"local"`               // lokal port yoki host:port
+	Subdomain     string `json:"subdomain,omitempty"` // serverdagi tunnel nomi (alice -> alice.<tunnel-domain>)
+	Token         string `json:"token,omitempty"`
+	LocalTLS      bool   `json:"local_tls,omitempty"`
+	LocalInsecure bool   `json:"local_insecure,omitempty"`
+	LocalCA       string `json:"local_ca,omitempty"`
+	LocalSNI      string `json:"local_sni,omitempty"`
+	LocalHost     string `json:"local_host,omitempty"`
+	PublicURL     string `json:"public_url,omitempty"`
+	Rewrite       bool   `json:"rewrite,omitempty"`
+	RewriteBody   bool   `json:"rewrite_body,omitempty"`
+	NoCompress    bool   `json:"no_compress,omitempty"`
+	Workers       int    `json:"workers,omitempty"`
+	URLFile       string `json:"url_file,omitempty"` // server e'lon qilgan URL yoziladigan fayl
+}
+
+// configFile - mytunnel.json: umumiy server/token va nomlangan tunnellar
+type configFile struct {
+	Server  string `json:"server"`
+	Token   string `json:"token"`
+	Control string `json:"control"`
+	// UpdateURL - "mytunnel update" uchun release manifesti manzili
+	UpdateURL string                   `json:"update_url"`
+	Tunnels   map[string]*tunnelConfig `json:"tunnels"`
+}
+
+// localAddr "8000" -> "localhost:8000", "127.0.0.1:8000" o'zgarmaydi
+func (c *tunnelConfig) localAddr() string {
+	if _, err := strconv.Atoi(c.Local); err == nil {
+		return net.JoinHostPort("localhost", c.Local)
+	}
+	return c.Local
+}
+
+// validate standart qiymatlarni qo'yadi va sozlamalarni tekshiradi
+func (c *tunnelConfig) validate() error {
+	if c.Proto == "" {
+		c.Proto = "tcp"
+	}
+	if c.Proto != "http" && c.Proto != "tcp" {
+		return fmt.Errorf("noma'lum protokol: %q (http yoki tcp)", c.Proto)
+	}
+	if c.Local == "" {
+		return fmt.Errorf("lokal port ko'rsatilmagan")
+	}
+	if _, _, err := net.SplitHostPort(c.localAddr()); err != nil {
+		return fmt.Errorf("noto'g'ri lokal manzil %q: %w", c.Local, err)
+	}
+	if c.Server == "" {
+		c.Server = defaultServer
+	}
+	if c.Workers <= 0 {
+		c.Workers = defaultWorkers
+	}
+	if (c.Rewrite || c.RewriteBody) && c.PublicURL == "" {
+		return fmt.Errorf("-rewrite uchun -public-url kerak")
+	}
+	if c.Name == "" {
+		c.Name = c.Subdomain
+		if c.Name == "" {
+			c.Name = c.Proto + "-" + c.Local
+		}
+	}
+	return nil
+}
+
+// upstream sozlamalardan lokal servis ulanishini tayyorlaydi
+func (c *tunnelConfig) upstream() (*upstream, error) {
+	local, err := newUpstream(c.localAddr(), c.LocalTLS || c.LocalInsecure || c.LocalCA != "", c.LocalInsecure, c.LocalCA, c.LocalSNI, c.LocalHost)
+	if err != nil {
+		return nil, err
+	}
+	local.http = c.Proto == "http"
+	if c.Rewrite || c.RewriteBody {
+		local.rewrite, err = newRewriter(local, c.PublicURL, c.RewriteBody)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return local, nil
+}
+
+// registerTunnelFlags tunnel flaglarini fs ga qo'shadi; -local faqat eski
+// (subcommand siz) rejimda kerak, subcommandlarda port argument sifatida beriladi
+func registerTunnelFlags(fs *flag.FlagSet, c *tunnelConfig) {
+	fs.StringVar(&c.Server, "server", defaultServer, "Server IP va port")
+	fs.StringVar(&c.Subdomain, "name", "", "Tunnel nomi (alice -> alice.<tunnel-domain>)")
+	fs.StringVar(&c.Token, "token", os.Getenv("MYTUNNEL_TOKEN"), "API token (band qilingan nomlar uchun)")
+	fs.BoolVar(&c.LocalTLS, "local-tls", false, "Lokal servisga TLS (https) orqali ulanish")
+	fs.BoolVar(&c.LocalInsecure, "local-insecure", false, "Lokal servis sertifikatini tekshirmaslik (self-signed)")
+	fs.StringVar(&c.LocalCA, "local-ca", "", "Lokal servis sertifikati uchun ishonchli CA fayli (PEM)")
+	fs.StringVar(&c.LocalSNI, "local-sni", "", "Lokal servisga yuboriladigan TLS SNI (standart: localhost)")
+	fs.StringVar(&c.LocalHost, "local-host", "", "Lokal servisga yuboriladigan Host sarlavhasi (masalan myapp.test)")
+	fs.StringVar(&c.PublicURL, "public-url", "", "Tunnelning tashqi manzili (masalan https://alice.tunnel.example.com)")
+	fs.BoolVar(&c.Rewrite, "rewrite", false, "Location va Set-Cookie dagi lokal manzillarni public URL ga almashtirish")
+	fs.BoolVar(&c.RewriteBody, "rewrite-body", false, "HTML/JSON javob body sidagi lokal manzillarni ham almashtirish")
+	fs.BoolFunc("compress", "Server bilan trafikni siqish (deflate), server qo'llasa (standart: true)", func(value string) error {
+		enabled, err := strconv.ParseBool(value)
+		c.NoCompress = !enabled
+		return err
+	})
+	fs.IntVar(&c.Workers, "workers", defaultWorkers, "Zaxira tunnel ulanishlari soni")
+	fs.StringVar(&c.URLFile, "url-file", "", "Public URL yoziladigan fayl (.json bo'lsa to'liq natija: URL, portlar, limitlar)")
+}
+
+// defaultConfigPath ./mytunnel.json yoki ~/.mytunnel.json
+func defaultConfigPath() string {
+	if _, err := os.Stat("mytunnel.json"); err == nil {
+		return "mytunnel.json"
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".mytunnel.json")
+	}
+	return "mytunnel.json"
+}
+
+// loadConfig config faylni o'qiydi; umumiy server/token har bir tunnelga qo'llanadi
+func loadConfig(path string) (*configFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config configFile
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, tunnel := range config.Tunnels {
+		if tunnel == nil {
+			return nil, fmt.Errorf("%s: %q tunneli bo'sh", path, name)
+		}
+		tunnel.Name = name
+		if tunnel.Server == "" {
+			tunnel.Server = config.Server
+		}
+		if tunnel.Token == "" {
+			tunnel.Token = config.Token
+		}
+	}
+	return &config, nil
+}
+
+// selectTunnels config dagi tunnellarni nomlari bo'yicha (yoki all - hammasini) tanlaydi
+func (c *configFile) selectTunnels(names []string, all bool) ([]*tunnelConfig, error) {
+	var selected []*tunnelConfig
+	if all {
+		for _, tunnel := range c.Tunnels {
+			selected = append(selected, tunnel)
+		}
+		if len(selected) == 0 {
+			return nil, fmt.Errorf("config da tunnellar yo'q")
+		}
+		return selected, nil
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("tunnel nomi yoki -all kerak")
+	}
+	for _, name := range names {
+		tunnel, ok := c.Tunnels[name]
+		if !ok {
+			return nil, fmt.Errorf("config da %q tunneli yo'q", name)
+		}
+		selected = append(selected, tunnel)
+	}
+	return selected, nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultControlAddr - ishlab turgan client bilan gaplashish manzili (faqat lokal)
+const defaultControlAddr = "127.0.0.1:4040"
+
+// ControlRequest - control socket orqali yuboriladigan buyruq (bir qator JSON)
+type ControlRequest struct {
+	Token  string        `json:"token"`            // control token fayli (controlTokenPath) mazmuni
+	Method string        `json:"method"`           // STATUS, ADD, REMOVE, STOP
+	Name   string        `json:"name,omitempty"`   // REMOVE/ADD uchun tunnel nomi
+	Tunnel *tunnelConfig `json:"tunnel,omitempty"` // ADD uchun tunnel sozlamalari
+}
+
+// ControlResponse - control socket javobi
+type ControlResponse struct {
+	Status  int             `json:"status"`
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// controlAddr -control flag, MYTUNNEL_CONTROL yoki standart manzil
+func controlAddr(flagValue string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if addr := os.Getenv("MYTUNNEL_CONTROL"); addr != "" {
+		return addr
+	}
+	return defaultControlAddr
+}
+
+// controlTokenPath - control manzili uchun token fayli:
+// ~/.mytunnel/control-<manzil>.token
+func controlTokenPath(addr string) (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	name := strings.Map(func(r rune) rune {
+		if r == ':' || r == '/' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, addr)
+	return filepath.Join(home, ".mytunnel", "control-"+name+".token"), nil
+}
+
+// writeControlToken yangi token yaratib faqat egasi o'qiy oladigan (0600)
+// faylga yozadi va fayl yo'lini qaytaradi. Socket lokal bo'lsa ham unga brauzerdagi sahifa yoki boshqa
+// foydalanuvchi ulanishi mumkin, token esa faqat shu foydalanuvchida bo'ladi.
+func writeControlToken(addr string) (token, path string, err error) {
+	path, err = controlTokenPath(addr)
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", "", err
+	}
+	token = newSessionID()
+	// Eski fayl boshqa ruxsatlar bilan qolgan bo'lishi mumkin
+	os.Remove(path)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := file.WriteString(token); err != nil {
+		file.Close()
+		return "", "", err
+	}
+	return token, path, file.Close()
+}
+
+// readControlToken ishlab turgan client yozgan tokenni o'qiydi
+func readControlToken(addr string) (string, error) {
+	path, err := controlTokenPath(addr)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// serveControl ishlab turgan tunnellarni boshqarish uchun lokal socket;
+// har bir so'rovda token bo'lishi kerak
+func serveControl(listener net.Listener, token string, tunnels *manager, stop func()) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go handleControl(conn, token, tunnels, stop)
+	}
+}
+
+// handleControl buyruqlarni o'qiydi. JSON bo'lmagan qator (masalan brauzer
+// yuborgan HTTP so'rovi) yoki noto'g'ri token kelsa ulanish darhol yopiladi.
+func handleControl(conn net.Conn, token string, tunnels *manager, stop func()) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		var req ControlRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			respondControl(conn, ControlResponse{Status: 400, Message: "Invalid JSON format"})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(req.Token), []byte(token)) != 1 {
+			respondControl(conn, ControlResponse{Status: 401, Message: "Control token noto'g'ri"})
+			return
+		}
+
+		respondControl(conn, processControl(req, tunnels))
+		if strings.ToUpper(req.Method) == "STOP" {
+			stop()
+			return
+		}
+	}
+}
+
+func processControl(req ControlRequest, tunnels *manager) ControlResponse {
+	switch strings.ToUpper(req.Method) {
+	case "STATUS":
+		return controlOK("Tunnellar holati", tunnels.statuses())
+
+	case "ADD":
+		if req.Tunnel == nil {
+			return ControlResponse{Status: 400, Message: "Tunnel sozlamalari kerak"}
+		}
+		req.Tunnel.Name = req.Name
+		status, err := tunnels.add(req.Tunnel)
+		if err != nil {
+			return ControlResponse{Status: 400, Message: err.Error()}
+		}
+		return controlOK("Tunnel qo'shildi", status)
+
+	case "REMOVE":
+		if !tunnels.remove(req.Name) {
+			return ControlResponse{Status: 404, Message: fmt.Sprintf("%q tunneli topilmadi", req.Name)}
+		}
+		return controlOK("Tunnel to'xtatildi", nil)
+
+	case "STOP":
+		return controlOK("Client to'xtatilmoqda", nil)
+
+	default:
+		return ControlResponse{Status: 400, Message: "Unknown method: " + req.Method}
+	}
+}
+
+func controlOK(message string, data interface{}) ControlResponse {
+	response := ControlResponse{Status: 200, Success: true, Message: message}
+	if data != nil {
+		response.Data, _ = json.Marshal(data)
+	}
+	return response
+}
+
+func respondControl(conn net.Conn, response ControlResponse) {
+	data, _ := json.Marshal(response)
+	conn.Write(append(data, '\n'))
+}
+
+// errNoClient - control manzilida ishlab turgan client yo'q
+var errNoClient = errors.New("ishlab turgan client topilmadi")
+
+// callControl ishlab turgan clientga buyruq yuboradi; data javobdagi
+// ma'lumot yoziladigan joy (nil bo'lishi mumkin)
+func callControl(addr string, req ControlRequest, data interface{}) (*ControlResponse, error) {
+	token, err := readControlToken(addr)
+	if err != nil {
+		return nil, errNoClient
+	}
+	req.Token = token
+
+	conn, err := net.DialTimeout("tcp", addr, 2*time.Second)
+	if err != nil {
+		return nil, errNoClient
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(append(payload, '\n')); err != nil {
+		return nil, err
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("control javobini o'qib bo'lmadi: %w", err)
+	}
+	var response ControlResponse
+	if err := json.Unmarshal(line, &response); err != nil {
+		return nil, err
+	}
+	if !response.Success {
+		return &response, errors.New(response.Message)
+	}
+	if data != nil && len(response.Data) > 0 {
+		if err := json.Unmarshal(response.Data, data); err != nil {
+			return &response, err
+		}
+	}
+	return &response, nil
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// rewriter lokal manzillarni (http://localhost:8000) javoblarda public tunnel
+// manziliga almashtiradi: Location, Set-Cookie Domain va (ixtiyoriy) HTML/JSON body
+type rewriter struct {
+	public  *url.URL
+	origins []string // lokal originlar: http://localhost:8000, http://127.0.0.1:8000, ...
+	hosts   []string // Set-Cookie Domain uchun lokal hostlar
+	body    bool
+	pairs   []replacePair
+}
+
+type replacePair struct {
+	old, new []byte
+}
+
+// newRewriter - local lokal servis, publicURL esa tunnelning tashqi manzili
+func newRewriter(local *upstream, publicURL string, rewriteBody bool) (*rewriter, error) {
+	public, err := url.Parse(strings.TrimRight(publicURL, "/"))
+	if err != nil || public.Scheme == "" || public.Host == "" {
+		return nil, fmt.Errorf("noto'g'ri public URL: %q", publicURL)
+	}
+
+	_, port, _ := net.SplitHostPort(local.addr)
+	hosts := []string{"localhost", "127.0.0.1"}
+	origins := []string{
+		local.scheme() + "://localhost:" + port,
+		local.scheme() + "://127.0.0.1:" + port,
+	}
+	if local.host != "" {
+		hostname := local.host
+		if h, _, err := net.SplitHostPort(hostname); err == nil {
+			hostname = h
+		}
+		hosts = append(hosts, hostname)
+		origins = append(origins, "http://"+local.host, "https://"+local.host)
+	}
+
+	rw := &rewriter{public: public, origins: origins, hosts: hosts, body: rewriteBody}
+	publicOrigin := public.Scheme + "://" + public.Host
+	for _, origin := range origins {
+		rw.pairs = append(rw.pairs, replacePair{old: []byte(origin), new: []byte(publicOrigin)})
+		// JSON da "/" ko'pincha "\/" ko'rinishida keladi (Laravel, PHP json_encode)
+		rw.pairs = append(rw.pairs, replacePair{
+			old: []byte(strings.ReplaceAll(origin, "/", `\/`)),
+			new: []byte(strings.ReplaceAll(publicOrigin, "/", `\/`)),
+		})
+	}
+	// Bir joyda bir nechta mos kelsa uzunrog'i tanlanadi
+	sort.SliceStable(rw.pairs, func(i, j int) bool { return len(rw.pairs[i].old) > len(rw.pairs[j].old) })
+	return rw, nil
+}
+
+// response javob sarlavhalari va kerak bo'lsa body ni qayta yozadi.
+// req - tunneldan kelgan asl so'rov (protokol versiyasi uchun).
+func (rw *rewriter) response(resp *http.Response, req *http.Request) {
+	if location := resp.Header.Get("Location"); location != "" {
+		resp.Header.Set("Location", rw.rewriteURL(location))
+	}
+
+	if cookies := resp.Header.Values("Set-Cookie"); len(cookies) > 0 {
+		resp.Header.Del("Set-Cookie")
+		for _, cookie := range cookies {
+			resp.Header.Add("Set-Cookie", rw.rewriteCookie(cookie))
+		}
+	}
+
+	noBody := req.Method == http.MethodHead || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified
+	if rw.body && !noBody && rewritableBody(resp) {
+		rw.rewriteBody(resp, req)
+	}
+}
+
+func (rw *rewriter) rewriteURL(location string) string {
+	for _, origin := range rw.origins {
+		if rest, ok := strings.CutPrefix(location, origin); ok && (rest == "" || strings.IndexAny(rest[:1], "/?#") == 0) {
+			return rw.public.Scheme + "://" + rw.public.Host + rest
+		}
+	}
+	return location
+}
+
+// rewriteCookie faqat Domain atributini o'zgartiradi, qolganlari o'z holicha qoladi
+func (rw *rewriter) rewriteCookie(cookie string) string {
+	parts := strings.Split(cookie, ";")
+	for i, part := range parts[1:] {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || !strings.EqualFold(key, "domain") {
+			continue
+		}
+		domain := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(value)), ".")
+		for _, host := range rw.hosts {
+			if domain == host {
+				parts[i+1] = " Domain=" + rw.public.Hostname()
+				break
+			}
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// rewritableBody - faqat HTML va JSON, siqilmagan yoki gzip
+func rewritableBody(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	textual := mediaType == "text/html" || mediaType == "application/xhtml+xml" ||
+		mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+	if !textual {
+		return false
+	}
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "", "identity", "gzip":
+		return true
+	}
+	return false
+}
+
+// rewriteBody body ni oqim sifatida qayta yozadi. Uzunlik o'zgargani uchun
+// Content-Length olib tashlanadi: HTTP/1.1 da chunked, HTTP/1.0 da ulanish yopiladi.
+func (rw *rewriter) rewriteBody(resp *http.Response, req *http.Request) {
+	original := resp.Body
+	gzipped := strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip")
+
+	var body io.Reader = original
+	if gzipped {
+		// gzip sarlavhasini o'qishda olingan baytlar eslab qolinadi: gzip
+		// bo'lmasa yoki bo'sh body bo'lsa javob o'zgarishsiz uzatiladi
+		recorder := &headerRecorder{r: original, on: true}
+		gz, err := gzip.NewReader(recorder)
+		if err != nil {
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(recorder.buf), original), original}
+			return
+		}
+		recorder.on, recorder.buf = false, nil
+		body = newReplaceReader(gz, rw.pairs)
+		body = gzipStream(body)
+	} else {
+		body = newReplaceReader(body, rw.pairs)
+	}
+
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, original}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	if req.ProtoAtLeast(1, 1) {
+		resp.TransferEncoding = []string{"chunked"}
+	} else {
+		resp.TransferEncoding = nil
+		resp.Close = true
+	}
+}
+
+// headerRecorder on bo'lganda o'qilgan baytlarni buf ga ham yozadi
+type headerRecorder struct {
+	r   io.Reader
+	buf []byte
+	on  bool
+}
+
+func (h *headerRecorder) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	if h.on {
+		h.buf = append(h.buf, p[:n]...)
+	}
+	return n, err
+}
+
+// gzipStream r ni qayta siqadi; har bir bo'lak flush qilinadi (streaming javoblar uchun)
+func gzipStream(r io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+	go func() {
+		gz := gzip.NewWriter(pw)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := r.Read(buf)
+			if n > 0 {
+				if _, werr := gz.Write(buf[:n]); werr != nil {
+					pw.CloseWithError(werr)
+					return
+				}
+				if werr := gz.Flush(); werr != nil {
+					pw.CloseWithError(werr)
+					return
+				}
+			}
+			if err == io.EOF {
+				pw.CloseWithError(gz.Close())
+				return
+			}
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return pr
+}
+
+// replaceReader oqimda bir nechta ketma-ketlikni almashtiradi. Bo'laklar
+// chegarasida kesilib qolgan moslik uchun oxirgi (maxLen-1) bayt ushlab turiladi.
+// Origin faqat to'liq bo'lsa almashtiriladi: http://localhost:8000 ichida
+// http://localhost:800 topilmaydi (keyingi bayt host davomi bo'lmasligi kerak).
+type replaceReader struct {
+	src    io.Reader
+	pairs  []replacePair
+	maxLen int
+	buf    []byte
+	in     []byte
+	out    []byte
+	err    error
+}
+
+func newReplaceReader(src io.Reader, pairs []replacePair) *replaceReader {
+	maxLen := 0
+	for _, pair := range pairs {
+		if len(pair.old) > maxLen {
+			maxLen = len(pair.old)
+		}
+	}
+	return &replaceReader{src: src, pairs: pairs, maxLen: maxLen, buf: make([]byte, 32*1024)}
+}
+
+func (r *replaceReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		n, err := r.src.Read(r.buf)
+		r.in = append(r.in, r.buf[:n]...)
+		if err != nil {
+			r.err = err
+		}
+		r.process(r.err != nil)
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *replaceReader) process(final bool) {
+	for {
+		at, match, pending := -1, -1, false
+		for i, pair := range r.pairs {
+			if idx, wait := r.find(pair.old, final); idx >= 0 && (at < 0 || idx < at) {
+				at, match, pending = idx, i, wait
+			}
+		}
+		if at < 0 {
+			break
+		}
+		if pending {
+			// Moslik bufer oxirida: chegarani bilish uchun keyingi bayt kerak
+			r.out = append(r.out, r.in[:at]...)
+			r.in = append([]byte(nil), r.in[at:]...)
+			return
+		}
+		r.out = append(r.out, r.in[:at]...)
+		r.out = append(r.out, r.pairs[match].new...)
+		r.in = r.in[at+len(r.pairs[match].old):]
+	}
+
+	keep := 0
+	if !final && r.maxLen > 0 {
+		keep = min(len(r.in), r.maxLen-1)
+	}
+	r.out = append(r.out, r.in[:len(r.in)-keep]...)
+	r.in = append([]byte(nil), r.in[len(r.in)-keep:]...)
+}
+
+// find old ning chegarasi to'g'ri bo'lgan birinchi o'rnini qaytaradi;
+// pending - moslik bufer oxirida va oqim hali tugamagan
+func (r *replaceReader) find(old []byte, final bool) (at int, pending bool) {
+	from := 0
+	for {
+		idx := bytes.Index(r.in[from:], old)
+		if idx < 0 {
+			return -1, false
+		}
+		at = from + idx
+		end := at + len(old)
+		if end == len(r.in) {
+			return at, !final
+		}
+		if !hostByte(r.in[end]) {
+			return at, false
+		}
+		from = at + 1
+	}
+}
+
+// hostByte - host yoki port davomi bo'la oladigan bayt. Location dagi kabi
+// "/?#" va satr oxiri chegara; body da qo'shtirnoq, bo'shliq, "<", "\" ham.
+func hostByte(b byte) bool {
+	return 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' ||
+		b == '.' || b == '-' || b == '_' || b == ':'
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-tunnel/tunnel"
+)
+
+var requestID int64
+
+// TunnelStatus - "mytunnel status" va control socket javobidagi tunnel holati
+type TunnelStatus struct {
+	Name        string    `json:"name"`
+	Proto       string    `json:"proto"`
+	Local       string    `json:"local"`
+	Server      string    `json:"server"`
+	Subdomain   string    `json:"subdomain,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	Connected   int64     `json:"connected"`   // server bilan tanishuvdan o'tgan zaxira ulanishlar
+	Active      int64     `json:"active"`      // hozir ma'lumot uzatayotgan ulanishlar
+	Connections int64     `json:"connections"` // jami xizmat qilingan ulanishlar
+	Error       string    `json:"error,omitempty"`
+	// Registration - server e'lon qilgan public URL, portlar va limitlar
+	Registration *tunnel.Registration `json:"registration,omitempty"`
+}
+
+// newSessionID - bitta tunnel ishga tushishining tasodifiy ID'si; server
+// band bo'lmagan nomni ham shu sessiyaga bog'laydi
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// tunnelRunner - bitta tunnelning zaxira ulanishlari (workers)
+type tunnelRunner struct {
+	config *tunnelConfig
+	local  *upstream
+	hello  tunnel.Hello
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	startedAt   time.Time
+	connected   atomic.Int64
+	active      atomic.Int64
+	connections atomic.Int64
+
+	// legacy - server hello ga javob bermadi (v1 server): ulanishlar
+	// hello siz, nom, siqish va URL e'lonisiz ochiladi
+	legacy atomic.Bool
+
+	mu           sync.Mutex
+	err          error                // server tunnelni rad etgan bo'lsa
+	registration *tunnel.Registration // serverning oxirgi javobi
+}
+
+func newTunnelRunner(config *tunnelConfig) (*tunnelRunner, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	local, err := config.upstream()
+	if err != nil {
+		return nil, err
+	}
+
+	hello := tunnel.Hello{
+		Version:       tunnel.ProtocolVersion,
+		Features:      tunnel.Features,
+		ClientVersion: version,
+		Name:          config.Subdomain,
+		Token:         config.Token,
+		Session:       newSessionID(),
+	}
+	if !config.NoCompress {
+		hello.Compression = []string{tunnel.CompressionDeflate}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &tunnelRunner{
+		config:    config,
+		local:     local,
+		hello:     hello,
+		ctx:       ctx,
+		cancel:    cancel,
+		startedAt: time.Now(),
+	}, nil
+}
+
+// start zaxira ulanishlarni ishga tushiradi
+func (t *tunnelRunner) start() {
+	for i := 0; i < t.config.Workers; i++ {
+		t.wg.Add(1)
+		go func() {
+			defer t.wg.Done()
+			t.worker()
+		}()
+	}
+}
+
+// stop barcha ulanishlarni yopadi va workerlar tugashini kutadi
+func (t *tunnelRunner) stop() {
+	t.cancel()
+	t.wg.Wait()
+}
+
+// done tunnel to'xtatilganda (stop yoki rad etilganda) yopiladi
+func (t *tunnelRunner) done() <-chan struct{} {
+	return t.ctx.Done()
+}
+
+func (t *tunnelRunner) fail(err error) {
+	t.mu.Lock()
+	if t.err == nil {
+		t.err = err
+	}
+	t.mu.Unlock()
+	t.cancel()
+}
+
+func (t *tunnelRunner) failure() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+func (t *tunnelRunner) status() TunnelStatus {
+	status := TunnelStatus{
+		Name:        t.config.Name,
+		Proto:       t.config.Proto,
+		Local:       t.localURL(),
+		Server:      t.config.Server,
+		Subdomain:   t.config.Subdomain,
+		StartedAt:   t.startedAt,
+		Connected:   t.connected.Load(),
+		Active:      t.active.Load(),
+		Connections: t.connections.Load(),
+	}
+	if err := t.failure(); err != nil {
+		status.Error = err.Error()
+	}
+	t.mu.Lock()
+	status.Registration = t.registration
+	t.mu.Unlock()
+	return status
+}
+
+// registered server e'lon qilgan natijani saqlaydi; birinchi marta (yoki
+// o'zgarganda) ekranga chiqaradi va -url-file ga yozadi
+func (t *tunnelRunner) registered(registration *tunnel.Registration) {
+	t.mu.Lock()
+	changed := t.registration == nil || !reflect.DeepEqual(t.registration, registration)
+	t.registration = registration
+	t.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	fmt.Println("--------------------------------------------")
+	if len(registration.URLs) == 0 {
+		fmt.Printf("%s: server public URL e'lon qilmadi (tunnel domeni sozlanmagan)\n", t.config.Name)
+	}
+	for _, url := range registration.URLs {
+		fmt.Printf("%s: %s -> %s\n", t.config.Name, url, t.localURL())
+	}
+	fmt.Printf("Server: %s (versiya %s), zaxira limiti: %d\n", t.config.Server, registration.ServerVersion, registration.Limits.MaxIdle)
+	if t.config.Workers > registration.Limits.MaxIdle && registration.Limits.MaxIdle > 0 {
+		fmt.Printf("OGOHLANTIRISH: -workers (%d) server limitidan (%d) katta\n", t.config.Workers, registration.Limits.MaxIdle)
+	}
+	fmt.Println("--------------------------------------------")
+
+	if t.config.URLFile != "" {
+		if err := writeURLFile(t.config.URLFile, registration); err != nil {
+			fmt.Printf("XATO: %s ga yozib bo'lmadi: %v\n", t.config.URLFile, err)
+		}
+	}
+}
+
+// writeURLFile skriptlar uchun: .json bo'lsa to'liq natija, aks holda asosiy URL
+func writeURLFile(path string, registration *tunnel.Registration) error {
+	var data []byte
+	if strings.HasSuffix(path, ".json") {
+		encoded, err := json.MarshalIndent(registration, "", "  ")
+		if err != nil {
+			return err
+		}
+		data = append(encoded, '\n')
+	} else if len(registration.URLs) > 0 {
+		data = []byte(registration.URLs[0] + "\n")
+	}
+
+	// Skript yarim yozilgan faylni o'qimasligi uchun avval vaqtinchalik faylga
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// localURL - lokal servis manzili: http(s)://... yoki tcp/tls://...
+func (t *tunnelRunner) localURL() string {
+	switch {
+	case t.local.httpMode():
+		return t.local.scheme() + "://" + t.local.addr
+	case t.local.tlsConfig != nil:
+		return "tls://" + t.local.addr
+	default:
+		return "tcp://" + t.local.addr
+	}
+}
+
+// sleep kutadi; tunnel to'xtatilsa darhol qaytadi
+func (t *tunnelRunner) sleep(d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-t.ctx.Done():
+	}
+}
+
+func (t *tunnelRunner) worker() {
+	dialer := net.Dialer{Timeout: 10 * time.Second}
+	for t.ctx.Err() == nil {
+		conn, err := dialer.DialContext(t.ctx, "tcp", t.config.Server)
+		if err != nil {
+			t.sleep(3 * time.Second)
+			continue
+		}
+
+		// Tunnel to'xtatilganda kutib turgan ulanish ham yopiladi
+		stopClose := context.AfterFunc(t.ctx, func() { conn.Close() })
+		t.serve(conn)
+		stopClose()
+		conn.Close()
+	}
+}
+
+// handshake server bilan tanishadi: tunnel nomi va token. v1 serverda
+// ulanish o'zgarishsiz ishlatiladi; ok=false bo'lsa ulanish tashlanadi
+func (t *tunnelRunner) handshake(conn net.Conn) (net.Conn, bool) {
+	if t.legacy.Load() {
+		return conn, true
+	}
+
+	tunnelConn, result, err := tunnel.Handshake(conn, t.hello)
+	switch {
+	case errors.Is(err, tunnel.ErrNoHelloResult):
+		// Hello qatori eski serverning zaxirasiga tushdi - bu ulanish yopiladi,
+		// keyingilari hello siz ochiladi
+		if t.legacy.CompareAndSwap(false, true) {
+			fmt.Printf("OGOHLANTIRISH: %q: server hello ga javob bermadi, eski (v1) server deb hisoblanadi: nom, siqish va URL e'loni o'chirildi\n", t.config.Name)
+		}
+		return nil, false
+	case errors.Is(err, tunnel.ErrRejected):
+		fmt.Printf("XATO: Server %q tunnelini rad etdi: %s\n", t.config.Name, result.Error)
+		t.fail(fmt.Errorf("server rad etdi: %s", result.Error))
+		return nil, false
+	case errors.Is(err, tunnel.ErrIncompatible):
+		fmt.Printf("XATO: %q: server bilan protokol mos emas (%v), server versiyasi %s\n", t.config.Name, err, result.ServerVersion)
+		t.fail(err)
+		return nil, false
+	case err != nil:
+		t.sleep(3 * time.Second)
+		return nil, false
+	}
+
+	if result.Registration != nil {
+		t.registered(result.Registration)
+	}
+	return tunnelConn, true
+}
+
+// serve bitta zaxira ulanishga xizmat qiladi: tanishuv, so'rovni kutish, uzatish
+func (t *tunnelRunner) serve(conn net.Conn) {
+	tunnelConn, ok := t.handshake(conn)
+	if !ok {
+		return
+	}
+
+	t.connected.Add(1)
+	defer t.connected.Add(-1)
+
+	// Serverdan birinchi bayt kelishini kutamiz (Request boshlanishi)
+	reader := bufio.NewReader(tunnelConn)
+	if _, err := reader.Peek(1); err != nil {
+		tunnelConn.Close()
+		return
+	}
+
+	t.active.Add(1)
+	defer t.active.Add(-1)
+	t.connections.Add(1)
+
+	id := atomic.AddInt64(&requestID, 1)
+	fmt.Printf("[Conn #%d] %s: tunnel ishga tushdi. Clientga yo'naltirilmoqda...\n", id, t.config.Name)
+
+	if t.local.httpMode() {
+		t.local.serveHTTP(id, tunnelConn, reader)
+		printCompression(id, tunnelConn)
+		fmt.Printf("[Conn #%d] Tugallandi.\n", id)
+		return
+	}
+
+	localConn, err := t.local.dial()
+	if err != nil {
+		fmt.Printf("[Conn #%d] XATO: Clientga ulanib bo'lmadi: %v\n", id, err)
+		tunnelConn.Close()
+		return
+	}
+
+	// Ma'lumot almashinuvi (bufferdagi birinchi paket ham shu orqali ketadi).
+	// TCP rejimida Content-Type yo'q: siqilmaydigan oqimni faqat
+	// CompressedConn ning ketma-ket "siqilmadi" hisobi to'xtatadi
+	handle(id, tunnel.NewBufferedConn(tunnelConn, reader), localConn)
+	printCompression(id, tunnelConn)
+}
+
+func handle(id int64, tunnel, local net.Conn) {
+	defer tunnel.Close()
+	defer local.Close()
+
+	done := make(chan struct{}, 2)
+
+	// Client -> Server (Laraveldan javobni Serverga)
+	go func() {
+		n, _ := io.Copy(tunnel, local)
+		if n > 0 {
+			fmt.Printf("[Conn #%d] Clientdan javob: %d bytes serverga ketdi\n", id, n)
+		}
+		done <- struct{}{}
+	}()
+
+	// Server -> Client (Serverdan so'rovni Laravelga)
+	go func() {
+		n, _ := io.Copy(local, tunnel)
+		if n > 0 {
+			fmt.Printf("[Conn #%d] Serverdan so'rov: %d bytes Clientga keldi\n", id, n)
+		}
+		done <- struct{}{}
+	}()
+
+	<-done
+	fmt.Printf("[Conn #%d] Tugallandi.\n", id)
+}
+
+// printCompression siqilgan tunnel ulanishi statistikasini chiqaradi
+func printCompression(id int64, conn net.Conn) {
+	compressed, ok := conn.(*tunnel.CompressedConn)
+	if !ok {
+		return
+	}
+	stats := compressed.Stats()
+	if stats.RawIn+stats.RawOut == 0 {
+		return
+	}
+	fmt.Printf("[Conn #%d] Siqish: %d -> %d bytes (%.2fx)\n", id,
+		stats.RawIn+stats.RawOut, stats.WireIn+stats.WireOut, stats.Ratio())
+}
+
+// manager - bitta client jarayonidagi barcha tunnellar
+type manager struct {
+	mu      sync.Mutex
+	tunnels map[string]*tunnelRunner
+	empty   chan struct{} // oxirgi tunnel to'xtaganda yopiladi
+	once    sync.Once
+	failed  bool // biror tunnel server tomonidan rad etilgan
+}
+
+func newManager() *manager {
+	return &manager{
+		tunnels: make(map[string]*tunnelRunner),
+		empty:   make(chan struct{}),
+	}
+}
+
+// add yangi tunnelni ishga tushiradi
+func (m *manager) add(config *tunnelConfig) (TunnelStatus, error) {
+	runner, err := newTunnelRunner(config)
+	if err != nil {
+		return TunnelStatus{}, err
+	}
+
+	m.mu.Lock()
+	if _, exists := m.tunnels[config.Name]; exists {
+		m.mu.Unlock()
+		return TunnelStatus{}, fmt.Errorf("%q tunneli allaqachon ishlayapti", config.Name)
+	}
+	m.tunnels[config.Name] = runner
+	m.mu.Unlock()
+
+	runner.start()
+	fmt.Printf("Tunnel qo'shildi: %s (%s) %s -> %s\n", config.Name, config.Proto, config.Server, runner.localURL())
+
+	// Server rad etsa tunnel ro'yxatdan olib tashlanadi
+	go func() {
+		<-runner.done()
+		if runner.failure() != nil {
+			m.remove(config.Name)
+		}
+	}()
+	return runner.status(), nil
+}
+
+// remove tunnelni to'xtatadi; tunnel topilmasa false
+func (m *manager) remove(name string) bool {
+	m.mu.Lock()
+	runner, ok := m.tunnels[name]
+	if ok {
+		delete(m.tunnels, name)
+		if runner.failure() != nil {
+			m.failed = true
+		}
+	}
+	last := ok && len(m.tunnels) == 0
+	m.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+	runner.stop()
+	fmt.Printf("Tunnel to'xtatildi: %s\n", name)
+	if last {
+		m.once.Do(func() { close(m.empty) })
+	}
+	return true
+}
+
+// stopAll barcha tunnellarni to'xtatadi
+func (m *manager) stopAll() {
+	for _, status := range m.statuses() {
+		m.remove(status.Name)
+	}
+}
+
+func (m *manager) statuses() []TunnelStatus {
+	m.mu.Lock()
+	statuses := make([]TunnelStatus, 0, len(m.tunnels))
+	for _, runner := range m.tunnels {
+		statuses = append(statuses, runner.status())
+	}
+	m.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// wait oxirgi tunnel to'xtaguncha kutadi; biror tunnel rad etilgan bo'lsa false
+func (m *manager) wait() bool {
+	<-m.empty
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.failed
+}
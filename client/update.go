@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"go-tunnel/release"
+)
+
+// updateKey - release manifestini imzolagan ed25519 public key (base64),
+// build.go -ldflags orqali beriladi
+var updateKey = ""
+
+// runUpdateCommand - mytunnel update: manifestni tekshirib, binarni almashtiradi
+func runUpdateCommand(args []string) {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	manifestURL := fs.String("manifest", os.Getenv("MYTUNNEL_UPDATE_URL"), "Release manifesti: URL (http://api/releases/manifest.json) yoki lokal fayl")
+	key := fs.String("key", envOr("MYTUNNEL_UPDATE_KEY", updateKey), "Manifest imzosini tekshirish uchun ed25519 public key (base64)")
+	checkOnly := fs.Bool("check", false, "Faqat yangi versiya borligini tekshirish")
+	force := fs.Bool("force", false, "Versiya yangi bo'lmasa ham almashtirish")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Foydalanish: mytunnel update [-manifest URL] [-check] [-force]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *manifestURL == "" {
+		if config, err := loadConfig(defaultConfigPath()); err == nil {
+			*manifestURL = config.UpdateURL
+		}
+	}
+	if *manifestURL == "" {
+		fmt.Println("XATO: manifest manzili yo'q (-manifest, MYTUNNEL_UPDATE_URL yoki config dagi update_url)")
+		os.Exit(1)
+	}
+	if *key == "" {
+		fmt.Println("XATO: imzo kaliti yo'q (-key yoki MYTUNNEL_UPDATE_KEY), imzosiz yangilanish o'rnatilmaydi")
+		os.Exit(1)
+	}
+
+	if err := update(*manifestURL, *key, *checkOnly, *force); err != nil {
+		fmt.Printf("XATO: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func update(source, encodedKey string, checkOnly, force bool) error {
+	key, err := release.ParsePublicKey(encodedKey)
+	if err != nil {
+		return err
+	}
+	manifest, err := release.FetchManifest(source, key)
+	if err != nil {
+		return err
+	}
+
+	cmp := release.CompareVersions(manifest.Version, version)
+	fmt.Printf("Joriy versiya: %s, release: %s\n", version, manifest.Version)
+	if cmp <= 0 && !force {
+		fmt.Println("Yangilanish kerak emas")
+		return nil
+	}
+	if checkOnly {
+		fmt.Println("Yangi versiya mavjud: mytunnel update")
+		return nil
+	}
+
+	artifact, ok := manifest.Find("client", runtime.GOOS, runtime.GOARCH)
+	if !ok {
+		return fmt.Errorf("release da %s/%s uchun client yo'q", runtime.GOOS, runtime.GOARCH)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	if err := replaceBinary(exe, source, artifact); err != nil {
+		return err
+	}
+
+	fmt.Printf("Yangilandi: %s -> %s (%s)\n", version, manifest.Version, exe)
+	if _, err := callControl(controlAddr(""), ControlRequest{Method: "STATUS"}, nil); err == nil {
+		fmt.Println("Ishlab turgan client eski versiyada: mytunnel stop va qayta ishga tushiring")
+	}
+	return nil
+}
+
+// replaceBinary yangi binarni yonidagi vaqtinchalik faylga yuklab, tekshirib,
+// bitta rename bilan almashtiradi: yarim yozilgan binar hech qachon ishga tushmaydi
+func replaceBinary(exe, source string, artifact *release.Artifact) error {
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".mytunnel-update-*")
+	if err != nil {
+		return fmt.Errorf("vaqtinchalik fayl: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	fmt.Printf("Yuklanmoqda: %s\n", release.Resolve(source, artifact.File))
+	if err := release.Download(source, artifact, tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return err
+	}
+
+	// Windows ishlab turgan binarni ustidan yozishga ruxsat bermaydi,
+	// lekin uni boshqa nomga o'tkazish mumkin
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp.Name(), exe); err != nil {
+			os.Rename(old, exe)
+			return err
+		}
+		return nil
+	}
+	return os.Rename(tmp.Name(), exe)
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
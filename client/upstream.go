@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go-tunnel/tunnel"
+)
+
+// upstream - tunnel orqali kelgan so'rovlar yuboriladigan lokal servis
+type upstream struct {
+	addr      string      // localhost:8000
+	tlsConfig *tls.Config // nil bo'lsa oddiy TCP, aks holda TLS (https://localhost:8443)
+	host      string      // lokal servisga yuboriladigan Host sarlavhasi ("" - o'zgartirilmaydi)
+	rewrite   *rewriter   // javoblardagi lokal manzillarni public URL ga almashtirish (nil - o'chiq)
+	http      bool        // "mytunnel http": so'rovlar har doim HTTP sifatida o'qiladi
+	transport *http.Transport
+}
+
+// newUpstream lokal servis sozlamalarini tayyorlaydi.
+// insecure - sertifikatni tekshirmaslik, caFile - qo'shimcha ishonchli CA (PEM),
+// sni - TLS ServerName (standart: addr dagi host).
+func newUpstream(addr string, useTLS, insecure bool, caFile, sni, host string) (*upstream, error) {
+	up := &upstream{addr: addr, host: host}
+
+	if useTLS {
+		config, err := localTLSConfig(addr, insecure, caFile, sni)
+		if err != nil {
+			return nil, err
+		}
+		up.tlsConfig = config
+	}
+
+	up.transport = &http.Transport{
+		Proxy:               nil,
+		TLSClientConfig:     up.tlsConfig,
+		DisableCompression:  true,
+		MaxIdleConnsPerHost: 25,
+		IdleConnTimeout:     90 * time.Second,
+		DialContext:         (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+	}
+	return up, nil
+}
+
+func localTLSConfig(addr string, insecure bool, caFile, sni string) (*tls.Config, error) {
+	if sni == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		sni = host
+	}
+
+	config := &tls.Config{
+		ServerName:         sni,
+		InsecureSkipVerify: insecure,
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("CA faylini o'qib bo'lmadi: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA faylida sertifikat topilmadi: %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
+
+// scheme lokal servis manzili sxemasi
+func (u *upstream) scheme() string {
+	if u.tlsConfig != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// httpMode - so'rovlarni HTTP sifatida o'qib, sarlavhalarni o'zgartirish kerakmi
+func (u *upstream) httpMode() bool {
+	return u.http || u.host != "" || u.rewrite != nil
+}
+
+// dial lokal servisga xom (TCP yoki TLS) ulanish ochadi
+func (u *upstream) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if u.tlsConfig != nil {
+		return tls.DialWithDialer(dialer, "tcp", u.addr, u.tlsConfig)
+	}
+	return dialer.Dial("tcp", u.addr)
+}
+
+// serveHTTP tunneldan HTTP so'rovlarni birma-bir o'qib lokal servisga yuboradi
+// (keep-alive bilan). WebSocket kabi Upgrade javoblaridan keyin xom uzatishga o'tadi.
+func (u *upstream) serveHTTP(id int64, tunnelConn net.Conn, reader *bufio.Reader) {
+	defer tunnelConn.Close()
+
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			if err != io.EOF {
+				fmt.Printf("[Conn #%d] So'rovni o'qib bo'lmadi: %v\n", id, err)
+			}
+			return
+		}
+
+		fmt.Printf("[Conn #%d] %s %s\n", id, req.Method, req.URL.RequestURI())
+
+		req.RequestURI = ""
+		req.URL.Scheme = u.scheme()
+		req.URL.Host = u.addr
+		if u.host != "" {
+			req.Host = u.host
+		}
+
+		resp, err := u.transport.RoundTrip(req)
+		if err != nil {
+			fmt.Printf("[Conn #%d] XATO: Clientga ulanib bo'lmadi: %v\n", id, err)
+			writeBadGateway(tunnelConn, err)
+			return
+		}
+
+		if resp.StatusCode == http.StatusSwitchingProtocols {
+			u.pipeUpgrade(id, tunnelConn, reader, resp)
+			return
+		}
+		if u.rewrite != nil {
+			u.rewrite.response(resp, req)
+		}
+		if compressed, ok := tunnelConn.(*tunnel.CompressedConn); ok {
+			compressed.SetCompression(compressibleResponse(resp))
+		}
+
+		// Sarlavhalar va body bo'laklari bitta yozuvga yig'iladi; upstreamdan
+		// keyingi bo'lakni kutishdan oldin flush qilinadi (streaming uchun)
+		out := bufio.NewWriterSize(tunnelConn, 32*1024)
+		resp.Body = &flushingBody{ReadCloser: resp.Body, w: out}
+		// io.Writer ga o'raymiz: bufio.Writer.ReadFrom o'z buferiga o'qiydi va
+		// flushingBody ichidagi Flush bilan to'qnashadi
+		err = resp.Write(struct{ io.Writer }{out})
+		if err == nil {
+			err = out.Flush()
+		}
+		resp.Body.Close()
+		if err != nil {
+			fmt.Printf("[Conn #%d] Javobni yuborib bo'lmadi: %v\n", id, err)
+			return
+		}
+		if req.Close || resp.Close {
+			return
+		}
+	}
+}
+
+// pipeUpgrade 101 javobidan keyin ikki tomonlama xom uzatish
+func (u *upstream) pipeUpgrade(id int64, tunnelConn net.Conn, reader *bufio.Reader, resp *http.Response) {
+	local, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return
+	}
+	defer local.Close()
+
+	resp.Body = nil
+	if err := resp.Write(tunnelConn); err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(tunnelConn, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, reader)
+		done <- struct{}{}
+	}()
+	<-done
+	fmt.Printf("[Conn #%d] Upgrade ulanishi tugallandi.\n", id)
+}
+
+// flushingBody har bir o'qishdan oldin yig'ilgan javobni tunnelga yuboradi
+type flushingBody struct {
+	io.ReadCloser
+	w *bufio.Writer
+}
+
+func (b *flushingBody) Read(p []byte) (int, error) {
+	if err := b.w.Flush(); err != nil {
+		return 0, err
+	}
+	return b.ReadCloser.Read(p)
+}
+
+// compressibleResponse - allaqachon siqilgan kontentni (rasm, video, arxiv,
+// Content-Encoding) tunnelda qayta siqishga urinmaymiz
+func compressibleResponse(resp *http.Response) bool {
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml",
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		mediaType == "font/woff", mediaType == "font/woff2",
+		mediaType == "application/zip", mediaType == "application/gzip",
+		mediaType == "application/x-gzip", mediaType == "application/x-7z-compressed",
+		mediaType == "application/x-rar-compressed", mediaType == "application/pdf":
+		return false
+	}
+	return true
+}
+
+func writeBadGateway(w io.Writer, err error) {
+	body := "Lokal servisga ulanib bo'lmadi: " + err.Error()
+	fmt.Fprintf(w, "HTTP/1.1 502 Bad Gateway\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", len(body), body)
+}
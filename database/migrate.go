@@ -17,7 +17,7 @@ import (
 
 const migrationsDir = "database/migrations"
 
-// func main() {
+func main() {
 	args := os.Args
 	if len(args) < 2 {
 		printUsage()
@@ -52,7 +52,7 @@ const migrationsDir = "database/migrations"
 		fmt.Println("Unknown action:", action)
 		printUsage()
 	}
-// }
+}
 
 func printUsage() {
 	fmt.Println(`
@@ -134,7 +134,8 @@ func getDB() *sql.DB {
 		)
 		db, err = sql.Open("postgres", dsn)
 	case "mysql":
-		dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s",
+		// Migration files hold several statements
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?multiStatements=true",
 			os.Getenv("DB_USER"),
 			os.Getenv("DB_PASSWORD"),
 			os.Getenv("DB_HOST"),
@@ -197,8 +198,10 @@ func getMigrationFiles() []string {
 
 	var migrations []string
 	for _, f := range files {
-		if strings.HasSuffix(f.Name(), ".up.sql") {
-			migrations = append(migrations, strings.TrimSuffix(f.Name(), ".up.sql"))
+		name, ok := strings.CutSuffix(f.Name(), ".up.sql")
+		// <name>.<driver>.up.sql is a variant of <name>, not a migration of its own
+		if ok && !strings.Contains(name, ".") {
+			migrations = append(migrations, name)
 		}
 	}
 
@@ -206,6 +209,17 @@ func getMigrationFiles() []string {
 	return migrations
 }
 
+// migrationFile returns the SQL file of a migration for the database driver:
+// <name>.<driver>.<direction>.sql when the migration needs dialect-specific
+// SQL, <name>.<direction>.sql otherwise
+func migrationFile(name, direction, dbDriver string) string {
+	specific := filepath.Join(migrationsDir, fmt.Sprintf("%s.%s.%s.sql", name, dbDriver, direction))
+	if _, err := os.Stat(specific); err == nil {
+		return specific
+	}
+	return filepath.Join(migrationsDir, fmt.Sprintf("%s.%s.sql", name, direction))
+}
+
 func getExecutedMigrations(db *sql.DB) map[string]bool {
 	executed := make(map[string]bool)
 	rows, err := db.Query("SELECT name FROM migrations ORDER BY name")
@@ -261,7 +275,7 @@ func migrateUp(count int) {
 	}
 
 	for _, migrationName := range pending {
-		upFile := filepath.Join(migrationsDir, migrationName+".up.sql")
+		upFile := migrationFile(migrationName, "up", dbDriver)
 		content, err := os.ReadFile(upFile)
 		if err != nil {
 			log.Printf("✗ Failed to read %s: %v\n", upFile, err)
@@ -336,7 +350,7 @@ func migrateDown(count int) {
 	}
 
 	for _, migrationName := range toRollback {
-		downFile := filepath.Join(migrationsDir, migrationName+".down.sql")
+		downFile := migrationFile(migrationName, "down", dbDriver)
 		content, err := os.ReadFile(downFile)
 		if err != nil {
 			log.Printf("✗ Failed to read %s: %v\n", downFile, err)
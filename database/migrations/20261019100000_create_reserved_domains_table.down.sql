@@ -0,0 +1,5 @@
+-- Migration: create_reserved_domains_table (DOWN)
+-- Created: 2026-10-19T10:00:00+05:00
+
+DROP INDEX IF EXISTS idx_reserved_domains_user_id;
+DROP TABLE IF EXISTS reserved_domains;
@@ -0,0 +1,4 @@
+-- Migration: create_reserved_domains_table (MySQL DOWN)
+-- Created: 2026-10-19T10:00:00+05:00
+
+DROP TABLE IF EXISTS reserved_domains;
@@ -0,0 +1,15 @@
+-- Migration: create_reserved_domains_table (MySQL UP)
+-- Created: 2026-10-19T10:00:00+05:00
+
+-- Create reserved_domains table for tunnel names (alice.<tunnel-domain>) owned by users.
+-- MySQL: user_id matches the BIGINT UNSIGNED of users.id (SERIAL) and the
+-- index is declared inline (no CREATE INDEX IF NOT EXISTS)
+CREATE TABLE IF NOT EXISTS reserved_domains (
+    id SERIAL PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    name VARCHAR(63) UNIQUE NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX idx_reserved_domains_user_id (user_id)
+);
@@ -0,0 +1,5 @@
+-- Migration: create_custom_domains_table (DOWN)
+-- Created: 2026-10-19T11:00:00+05:00
+
+DROP INDEX IF EXISTS idx_custom_domains_user_id;
+DROP TABLE IF EXISTS custom_domains;
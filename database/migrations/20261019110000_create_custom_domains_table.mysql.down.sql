@@ -0,0 +1,4 @@
+-- Migration: create_custom_domains_table (MySQL DOWN)
+-- Created: 2026-10-19T11:00:00+05:00
+
+DROP TABLE IF EXISTS custom_domains;
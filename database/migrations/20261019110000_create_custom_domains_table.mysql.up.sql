@@ -0,0 +1,17 @@
+-- Migration: create_custom_domains_table (MySQL UP)
+-- Created: 2026-10-19T11:00:00+05:00
+
+-- Create custom_domains table for customer domains (dev.customer.com) pointed at a reserved tunnel
+CREATE TABLE IF NOT EXISTS custom_domains (
+    id SERIAL PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL,
+    reserved_domain_id BIGINT UNSIGNED NOT NULL,
+    domain VARCHAR(253) UNIQUE NOT NULL,
+    verification_token VARCHAR(64) NOT NULL,
+    verified_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (reserved_domain_id) REFERENCES reserved_domains(id) ON DELETE CASCADE,
+    INDEX idx_custom_domains_user_id (user_id)
+);
@@ -0,0 +1,19 @@
+-- Migration: create_custom_domains_table (UP)
+-- Created: 2026-10-19T11:00:00+05:00
+
+-- Create custom_domains table for customer domains (dev.customer.com) pointed at a reserved tunnel
+CREATE TABLE IF NOT EXISTS custom_domains (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    reserved_domain_id INTEGER NOT NULL,
+    domain VARCHAR(253) UNIQUE NOT NULL,
+    verification_token VARCHAR(64) NOT NULL,
+    verified_at TIMESTAMP NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (reserved_domain_id) REFERENCES reserved_domains(id) ON DELETE CASCADE
+);
+
+-- Create index for listing a user's custom domains
+CREATE INDEX IF NOT EXISTS idx_custom_domains_user_id ON custom_domains(user_id);
@@ -0,0 +1,5 @@
+-- Migration: create_tunnel_sessions_table (DOWN)
+-- Created: 2026-10-19T12:00:00+05:00
+
+DROP INDEX IF EXISTS idx_tunnel_sessions_name;
+DROP TABLE IF EXISTS tunnel_sessions;
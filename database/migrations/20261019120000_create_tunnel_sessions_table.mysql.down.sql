@@ -0,0 +1,4 @@
+-- Migration: create_tunnel_sessions_table (MySQL DOWN)
+-- Created: 2026-10-19T12:00:00+05:00
+
+DROP TABLE IF EXISTS tunnel_sessions;
@@ -0,0 +1,15 @@
+-- Migration: create_tunnel_sessions_table (MySQL UP)
+-- Created: 2026-10-19T12:00:00+05:00
+
+-- Create tunnel_sessions table: which tunnel server node holds the control
+-- connections of a tunnel (shared registry for cluster mode)
+CREATE TABLE IF NOT EXISTS tunnel_sessions (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(63) NOT NULL,
+    node_id VARCHAR(255) NOT NULL,
+    node_addr VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (name, node_id),
+    INDEX idx_tunnel_sessions_name (name)
+);
@@ -0,0 +1,4 @@
+-- Migration: add_revoked_at_to_auth_tokens (DOWN)
+-- Created: 2026-10-19T13:00:00+05:00
+
+ALTER TABLE auth_tokens DROP COLUMN revoked_at;
@@ -0,0 +1,5 @@
+-- Migration: add_revoked_at_to_auth_tokens (UP)
+-- Created: 2026-10-19T13:00:00+05:00
+
+-- Revoked tokens keep their row (for auditing) but no longer authenticate
+ALTER TABLE auth_tokens ADD COLUMN revoked_at TIMESTAMP NULL;
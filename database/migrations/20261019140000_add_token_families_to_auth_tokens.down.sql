@@ -0,0 +1,7 @@
+-- Migration: add_token_families_to_auth_tokens (DOWN)
+-- Created: 2026-10-19T14:00:00+05:00
+
+DROP INDEX IF EXISTS idx_auth_tokens_family_id;
+ALTER TABLE auth_tokens DROP COLUMN used_at;
+ALTER TABLE auth_tokens DROP COLUMN family_id;
+ALTER TABLE auth_tokens DROP COLUMN kind;
@@ -0,0 +1,11 @@
+-- Migration: add_token_families_to_auth_tokens (UP)
+-- Created: 2026-10-19T14:00:00+05:00
+
+-- Access and refresh tokens of one login share a family_id; a refresh token
+-- is used once (used_at) and reusing it revokes the whole family
+ALTER TABLE auth_tokens ADD COLUMN kind VARCHAR(16) NOT NULL DEFAULT 'access';
+ALTER TABLE auth_tokens ADD COLUMN family_id VARCHAR(64) NULL;
+ALTER TABLE auth_tokens ADD COLUMN used_at TIMESTAMP NULL;
+
+-- Create index for revoking a family
+CREATE INDEX IF NOT EXISTS idx_auth_tokens_family_id ON auth_tokens(family_id);
@@ -0,0 +1,11 @@
+-- Migration: scope_custom_domain_uniqueness_to_verified (DOWN)
+-- Created: 2026-10-19T15:00:00+05:00
+
+DROP INDEX IF EXISTS idx_custom_domains_verified_domain;
+DROP INDEX IF EXISTS idx_custom_domains_user_domain;
+
+-- The old constraint allows one row per domain: competing unverified claims go
+DELETE FROM custom_domains
+WHERE verified_at IS NULL
+  AND domain IN (SELECT domain FROM custom_domains GROUP BY domain HAVING COUNT(*) > 1);
+ALTER TABLE custom_domains ADD CONSTRAINT custom_domains_domain_key UNIQUE (domain);
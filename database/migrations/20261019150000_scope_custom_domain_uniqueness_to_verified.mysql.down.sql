@@ -0,0 +1,15 @@
+-- Migration: scope_custom_domain_uniqueness_to_verified (MySQL DOWN)
+-- Created: 2026-10-19T15:00:00+05:00
+
+DROP INDEX idx_custom_domains_verified_domain ON custom_domains;
+ALTER TABLE custom_domains DROP COLUMN verified_domain;
+
+-- The old constraint allows one row per domain: competing unverified claims go
+-- (MySQL can't select from the table it deletes from, hence the derived table)
+DELETE FROM custom_domains
+WHERE verified_at IS NULL
+  AND domain IN (SELECT domain FROM (
+      SELECT domain FROM custom_domains GROUP BY domain HAVING COUNT(*) > 1
+  ) AS claimed);
+ALTER TABLE custom_domains ADD UNIQUE INDEX domain (domain);
+DROP INDEX idx_custom_domains_user_domain ON custom_domains;
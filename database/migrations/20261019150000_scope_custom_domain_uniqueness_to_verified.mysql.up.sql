@@ -0,0 +1,12 @@
+-- Migration: scope_custom_domain_uniqueness_to_verified (MySQL UP)
+-- Created: 2026-10-19T15:00:00+05:00
+
+-- An unverified claim must not block other users: several users may claim a
+-- domain, each once, and only one of them can hold it verified.
+-- MySQL has no partial indexes: verified_domain is the domain of verified
+-- rows and NULL otherwise, and a unique index allows any number of NULLs.
+ALTER TABLE custom_domains DROP INDEX domain;
+CREATE UNIQUE INDEX idx_custom_domains_user_domain ON custom_domains(user_id, domain);
+ALTER TABLE custom_domains ADD COLUMN verified_domain VARCHAR(253)
+    AS (CASE WHEN verified_at IS NOT NULL THEN domain END) STORED;
+CREATE UNIQUE INDEX idx_custom_domains_verified_domain ON custom_domains(verified_domain);
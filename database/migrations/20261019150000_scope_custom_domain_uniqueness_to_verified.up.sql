@@ -0,0 +1,8 @@
+-- Migration: scope_custom_domain_uniqueness_to_verified (UP)
+-- Created: 2026-10-19T15:00:00+05:00
+
+-- An unverified claim must not block other users: several users may claim a
+-- domain, each once, and only one of them can hold it verified
+ALTER TABLE custom_domains DROP CONSTRAINT IF EXISTS custom_domains_domain_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_custom_domains_user_domain ON custom_domains(user_id, domain);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_custom_domains_verified_domain ON custom_domains(domain) WHERE verified_at IS NOT NULL;
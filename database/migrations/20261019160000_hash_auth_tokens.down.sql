@@ -0,0 +1,6 @@
+-- Migration: hash_auth_tokens (DOWN)
+-- Created: 2026-10-19T16:00:00+05:00
+
+-- A hash can't be turned back into the token: revoke everything instead,
+-- users log in again
+UPDATE auth_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE revoked_at IS NULL;
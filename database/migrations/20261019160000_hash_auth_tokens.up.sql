@@ -0,0 +1,6 @@
+-- Migration: hash_auth_tokens (UP)
+-- Created: 2026-10-19T16:00:00+05:00
+
+-- auth_tokens.token now holds the hex SHA-256 of the token instead of the
+-- token itself; hash the rows issued so far so they keep working
+UPDATE auth_tokens SET token = encode(sha256(token::bytea), 'hex');
@@ -0,0 +1,4 @@
+-- Migration: add_owner_to_tunnel_sessions (DOWN)
+-- Created: 2026-10-19T17:00:00+05:00
+
+ALTER TABLE tunnel_sessions DROP COLUMN owner;
@@ -0,0 +1,6 @@
+-- Migration: add_owner_to_tunnel_sessions (UP)
+-- Created: 2026-10-19T17:00:00+05:00
+
+-- The client session (hashed) that holds a tunnel name; other nodes reject
+-- the name for a different session while this row is live
+ALTER TABLE tunnel_sessions ADD COLUMN owner VARCHAR(64) NOT NULL DEFAULT '';
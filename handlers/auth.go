@@ -2,7 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 
 	"go-tunnel/models"
 	"go-tunnel/services"
@@ -39,71 +43,176 @@ func AdminLogin(w http.ResponseWriter, r *http.Request) {
 	utils.SendResponse(w, true, "Admin login muvaffaqiyatli", map[string]interface{}{"email": req.Email})
 }
 
-// AdminGenerateToken generates a token for admin
-func AdminGenerateToken(w http.ResponseWriter, r *http.Request) {
-	// Generate token using service
-	token := services.GenerateAdminToken()
-	utils.SendResponse(w, true, "Token yaratildi", map[string]string{"token": token})
-}
+// LoginHandler is the legacy POST /login, same as POST /auth/login
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	// if r.Method == http.M
-    var req models.LoginRequest
-    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        utils.SendResponse(w, false, "Invalid JSON", nil)
-        return
-    }
-
-    if req.Email == "" || req.Password == "" {
-        utils.SendResponse(w, false, "Email va password kerak", nil)
-        return
-    }
-
-    // Example data
-    data := map[string]string{"email": req.Email}
-    utils.SendResponse(w, true, "Login muvaffaqiyatli", data)
+	Login(w, r)
 }
 
-// Login handler
+// Login checks email and password and issues an auth token
 func Login(w http.ResponseWriter, r *http.Request) {
 	var req models.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.SendResponse(w, false, "Invalid JSON", nil)
+		utils.SendStatusResponse(w, http.StatusBadRequest, false, "Invalid JSON", nil)
 		return
 	}
-
 	if req.Email == "" || req.Password == "" {
-		utils.SendResponse(w, false, "Email va password kerak", nil)
+		utils.SendStatusResponse(w, http.StatusBadRequest, false, "Email va password kerak", nil)
+		return
+	}
+
+	user, err := services.Login(req.Email, req.Password)
+	if errors.Is(err, services.ErrInvalidCredentials) {
+		utils.SendStatusResponse(w, http.StatusUnauthorized, false, "Email yoki parol noto'g'ri", nil)
+		return
+	}
+	if err != nil {
+		log.Printf("Login: %s: %v", utils.RequestID(r), err)
+		utils.SendStatusResponse(w, http.StatusInternalServerError, false, "Login qilib bo'lmadi", nil)
+		return
+	}
+
+	pair, err := services.IssueTokenPair(user.ID)
+	if err != nil {
+		log.Printf("Login: %s: token: %v", utils.RequestID(r), err)
+		utils.SendStatusResponse(w, http.StatusInternalServerError, false, "Token yaratib bo'lmadi", nil)
+		return
+	}
+	response, err := tokenResponse(pair, user)
+	if err != nil {
+		log.Printf("Login: %s: jwt: %v", utils.RequestID(r), err)
+		utils.SendStatusResponse(w, http.StatusInternalServerError, false, "Token yaratib bo'lmadi", nil)
 		return
 	}
+	utils.SendResponse(w, true, "Login muvaffaqiyatli", response)
+}
 
-	data := map[string]interface{}{
-		"email": req.Email,
-		"token": "example_token_12345",
+// tokenResponse is the login and refresh response for a token pair; with a
+// JWT signing key configured it also carries a JWT that expires together
+// with the access token
+func tokenResponse(pair *services.TokenPair, user *models.User) (models.TokenResponse, error) {
+	jwt, err := services.IssueJWT(pair.Access.UserID, pair.Access.ExpiresAt)
+	if err != nil {
+		return models.TokenResponse{}, err
 	}
-	utils.SendResponse(w, true, "Login muvaffaqiyatli", data)
+	return models.TokenResponse{
+		Token:            pair.Access.Value,
+		TokenType:        "Bearer",
+		ExpiresAt:        pair.Access.ExpiresAt,
+		RefreshToken:     pair.Refresh.Value,
+		RefreshExpiresAt: pair.Refresh.ExpiresAt,
+		JWT:              jwt,
+		User:             user,
+	}, nil
 }
 
-// Register handler
+// Register creates a user with a bcrypt-hashed password
 func Register(w http.ResponseWriter, r *http.Request) {
-	var req models.LoginRequest
+	var req models.RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		utils.SendResponse(w, false, "Invalid JSON", nil)
+		utils.SendStatusResponse(w, http.StatusBadRequest, false, "Invalid JSON", nil)
 		return
 	}
 
-	data := map[string]string{"email": req.Email}
-	utils.SendResponse(w, true, "Ro'yxatdan o'tish muvaffaqiyatli", data)
+	user, err := services.RegisterUser(req.Name, req.Email, req.Password)
+	switch {
+	case errors.Is(err, services.ErrInvalidEmail):
+		utils.SendStatusResponse(w, http.StatusUnprocessableEntity, false, "Noto'g'ri email", nil)
+	case errors.Is(err, services.ErrWeakPassword):
+		utils.SendStatusResponse(w, http.StatusUnprocessableEntity, false,
+			fmt.Sprintf("Parol kamida %d belgidan iborat bo'lishi kerak", services.MinPasswordLength), nil)
+	case errors.Is(err, services.ErrPasswordTooLong):
+		utils.SendStatusResponse(w, http.StatusUnprocessableEntity, false, "Parol juda uzun (72 baytgacha)", nil)
+	case errors.Is(err, services.ErrEmailTaken):
+		utils.SendStatusResponse(w, http.StatusConflict, false, "Bu email allaqachon ro'yxatdan o'tgan", nil)
+	case err != nil:
+		log.Printf("Register: %s: %v", utils.RequestID(r), err)
+		utils.SendStatusResponse(w, http.StatusInternalServerError, false, "Ro'yxatdan o'tkazib bo'lmadi", nil)
+	default:
+		utils.SendStatusResponse(w, http.StatusCreated, true, "Ro'yxatdan o'tish muvaffaqiyatli", user)
+	}
 }
 
-// Logout handler
+// Logout revokes the current session (the access token and its refresh
+// token); with ?all=true every session of the user. A JWT has no session to
+// revoke, it runs out by itself; with ?all=true the user's refresh tokens
+// are revoked so no new JWTs are issued.
 func Logout(w http.ResponseWriter, r *http.Request) {
-	utils.SendResponse(w, true, "Logout muvaffaqiyatli", nil)
+	user, token := utils.User(r), utils.AuthToken(r)
+	if user == nil {
+		utils.SendStatusResponse(w, http.StatusUnauthorized, false, "Token yaroqsiz", nil)
+		return
+	}
+
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	if token == nil && !all {
+		utils.SendStatusResponse(w, http.StatusBadRequest, false,
+			"JWT'ni bekor qilib bo'lmaydi, muddati tugashini kuting yoki ?all=true bilan barcha sessiyalardan chiqing", nil)
+		return
+	}
+	var err error
+	if all {
+		err = services.RevokeAllSessions(user.ID)
+	} else {
+		err = services.RevokeSession(token)
+	}
+	if err != nil {
+		log.Printf("Logout: %s: %v", utils.RequestID(r), err)
+		utils.SendStatusResponse(w, http.StatusInternalServerError, false, "Logout qilib bo'lmadi", nil)
+		return
+	}
+
+	message := "Logout muvaffaqiyatli"
+	if all {
+		message = "Barcha sessiyalardan chiqildi"
+	}
+	utils.SendResponse(w, true, message, nil)
 }
 
-// RefreshToken handler
+// RefreshToken exchanges a refresh token for a new token pair. Each refresh
+// token works once; reusing one revokes the whole session.
 func RefreshToken(w http.ResponseWriter, r *http.Request) {
-	data := map[string]string{"token": "new_token_12345"}
-	utils.SendResponse(w, true, "Token yangilandi", data)
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendStatusResponse(w, http.StatusBadRequest, false, "Invalid JSON", nil)
+		return
+	}
+	if req.RefreshToken == "" {
+		utils.SendStatusResponse(w, http.StatusBadRequest, false, "refresh_token kerak", nil)
+		return
+	}
+
+	pair, err := services.RefreshTokens(req.RefreshToken)
+	switch {
+	case errors.Is(err, services.ErrTokenReused):
+		utils.SendStatusResponse(w, http.StatusUnauthorized, false, "Refresh token qayta ishlatildi, sessiya bekor qilindi", nil)
+		return
+	case errors.Is(err, services.ErrTokenExpired):
+		utils.SendStatusResponse(w, http.StatusUnauthorized, false, "Refresh token muddati tugagan", nil)
+		return
+	case errors.Is(err, services.ErrTokenRevoked), errors.Is(err, services.ErrInvalidToken):
+		utils.SendStatusResponse(w, http.StatusUnauthorized, false, "Refresh token yaroqsiz", nil)
+		return
+	case err != nil:
+		log.Printf("RefreshToken: %s: %v", utils.RequestID(r), err)
+		utils.SendStatusResponse(w, http.StatusInternalServerError, false, "Token yangilab bo'lmadi", nil)
+		return
+	}
+	response, err := tokenResponse(pair, nil)
+	if err != nil {
+		log.Printf("RefreshToken: %s: jwt: %v", utils.RequestID(r), err)
+		utils.SendStatusResponse(w, http.StatusInternalServerError, false, "Token yangilab bo'lmadi", nil)
+		return
+	}
+	utils.SendResponse(w, true, "Token yangilandi", response)
+}
+
+// JWKS serves the public keys JWTs are verified with, for edge nodes that
+// check tokens without the database (JWT_JWKS_URL)
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	// Short enough for a rotated-in key to show up soon
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(services.JWKS())
 }
 
 // HealthCheck handler
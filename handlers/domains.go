@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go-tunnel/models"
+	"go-tunnel/services"
+	"go-tunnel/utils"
+)
+
+// ListCustomDomains returns the custom domains of the current user
+func ListCustomDomains(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.UserID(r)
+	if !ok {
+		utils.SendResponse(w, false, "Token yaroqsiz", nil)
+		return
+	}
+
+	domains, err := services.ListCustomDomains(userID)
+	if err != nil {
+		utils.SendResponse(w, false, "Domenlarni olib bo'lmadi", nil)
+		return
+	}
+	utils.SendResponse(w, true, "Domenlar ro'yxati", domains)
+}
+
+// AddCustomDomain registers a custom domain for a reserved tunnel and
+// returns the DNS records needed to verify it
+func AddCustomDomain(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.UserID(r)
+	if !ok {
+		utils.SendResponse(w, false, "Token yaroqsiz", nil)
+		return
+	}
+
+	var req models.CustomDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendResponse(w, false, "Invalid JSON", nil)
+		return
+	}
+
+	custom, err := services.AddCustomDomain(userID, req.Tunnel, req.Domain)
+	switch {
+	case errors.Is(err, services.ErrInvalidDomain):
+		utils.SendResponse(w, false, "Noto'g'ri domen", nil)
+	case errors.Is(err, services.ErrInvalidTunnelName), errors.Is(err, services.ErrTunnelNameNotFound):
+		utils.SendResponse(w, false, "Tunnel nomi sizga tegishli emas", nil)
+	case errors.Is(err, services.ErrDomainTaken):
+		utils.SendResponse(w, false, "Bu domenni boshqa foydalanuvchi tasdiqlagan", nil)
+	case err != nil:
+		utils.SendResponse(w, false, "Domenni qo'shib bo'lmadi", nil)
+	default:
+		utils.SendResponse(w, true, "Domen qo'shildi, DNS yozuvini tasdiqlang", map[string]interface{}{
+			"domain":       custom,
+			"verification": services.VerificationInstructions(custom),
+		})
+	}
+}
+
+// VerifyCustomDomain checks the DNS records of a custom domain
+func VerifyCustomDomain(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.UserID(r)
+	if !ok {
+		utils.SendResponse(w, false, "Token yaroqsiz", nil)
+		return
+	}
+
+	var req models.CustomDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendResponse(w, false, "Invalid JSON", nil)
+		return
+	}
+
+	custom, err := services.VerifyCustomDomain(r.Context(), userID, req.Domain)
+	switch {
+	case errors.Is(err, services.ErrInvalidDomain):
+		utils.SendResponse(w, false, "Noto'g'ri domen", nil)
+	case errors.Is(err, services.ErrDomainNotFound):
+		utils.SendResponse(w, false, "Domen topilmadi", nil)
+	case errors.Is(err, services.ErrDomainTaken):
+		utils.SendResponse(w, false, "Bu domenni boshqa foydalanuvchi tasdiqlagan", nil)
+	case errors.Is(err, services.ErrDomainNotVerified):
+		utils.SendResponse(w, false, "DNS yozuvi topilmadi yoki mos emas", map[string]interface{}{
+			"verification": services.VerificationInstructions(custom),
+		})
+	case err != nil:
+		utils.SendResponse(w, false, "Domenni tekshirib bo'lmadi", nil)
+	default:
+		utils.SendResponse(w, true, "Domen tasdiqlandi", custom)
+	}
+}
+
+// RemoveCustomDomain deletes a custom domain of the current user
+func RemoveCustomDomain(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.UserID(r)
+	if !ok {
+		utils.SendResponse(w, false, "Token yaroqsiz", nil)
+		return
+	}
+
+	var req models.CustomDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendResponse(w, false, "Invalid JSON", nil)
+		return
+	}
+
+	err := services.RemoveCustomDomain(userID, req.Domain)
+	switch {
+	case errors.Is(err, services.ErrInvalidDomain):
+		utils.SendResponse(w, false, "Noto'g'ri domen", nil)
+	case errors.Is(err, services.ErrDomainNotFound):
+		utils.SendResponse(w, false, "Domen topilmadi", nil)
+	case err != nil:
+		utils.SendResponse(w, false, "Domenni o'chirib bo'lmadi", nil)
+	default:
+		utils.SendResponse(w, true, "Domen o'chirildi", map[string]string{"domain": req.Domain})
+	}
+}
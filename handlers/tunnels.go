@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go-tunnel/models"
+	"go-tunnel/services"
+	"go-tunnel/utils"
+)
+
+// ListReservedDomains returns the tunnel names reserved by the current user
+func ListReservedDomains(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.UserID(r)
+	if !ok {
+		utils.SendResponse(w, false, "Token yaroqsiz", nil)
+		return
+	}
+
+	domains, err := services.ListReservedDomains(userID)
+	if err != nil {
+		utils.SendResponse(w, false, "Tunnel nomlarini olib bo'lmadi", nil)
+		return
+	}
+	utils.SendResponse(w, true, "Band qilingan tunnel nomlari", domains)
+}
+
+// ReserveDomain reserves a tunnel name for the current user
+func ReserveDomain(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.UserID(r)
+	if !ok {
+		utils.SendResponse(w, false, "Token yaroqsiz", nil)
+		return
+	}
+
+	var req models.ReserveDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendResponse(w, false, "Invalid JSON", nil)
+		return
+	}
+
+	domain, err := services.ReserveDomain(userID, req.Name)
+	switch {
+	case errors.Is(err, services.ErrInvalidTunnelName):
+		utils.SendResponse(w, false, "Noto'g'ri tunnel nomi (a-z, 0-9, '-', 3-63 belgi)", nil)
+	case errors.Is(err, services.ErrTunnelNameTaken):
+		utils.SendResponse(w, false, "Bu tunnel nomi allaqachon band", nil)
+	case err != nil:
+		utils.SendResponse(w, false, "Tunnel nomini band qilib bo'lmadi", nil)
+	default:
+		utils.SendResponse(w, true, "Tunnel nomi band qilindi", domain)
+	}
+}
+
+// ReleaseDomain releases a tunnel name reserved by the current user
+func ReleaseDomain(w http.ResponseWriter, r *http.Request) {
+	userID, ok := utils.UserID(r)
+	if !ok {
+		utils.SendResponse(w, false, "Token yaroqsiz", nil)
+		return
+	}
+
+	var req models.ReserveDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.SendResponse(w, false, "Invalid JSON", nil)
+		return
+	}
+
+	err := services.ReleaseDomain(userID, req.Name)
+	switch {
+	case errors.Is(err, services.ErrInvalidTunnelName):
+		utils.SendResponse(w, false, "Noto'g'ri tunnel nomi", nil)
+	case errors.Is(err, services.ErrTunnelNameNotFound):
+		utils.SendResponse(w, false, "Bu tunnel nomi sizga tegishli emas", nil)
+	case err != nil:
+		utils.SendResponse(w, false, "Tunnel nomini bo'shatib bo'lmadi", nil)
+	default:
+		utils.SendResponse(w, true, "Tunnel nomi bo'shatildi", map[string]string{"name": req.Name})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"go-tunnel/services"
 	"go-tunnel/utils"
 )
 
@@ -34,8 +35,9 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 
 // GetUser returns a single user
 func GetUser(w http.ResponseWriter, r *http.Request) {
+	id, _ := utils.ParamInt(r, "id")
 	data := map[string]interface{}{
-		"id": 1,
+		"id": id,
 		"name": "Ali",
 		"email": "ali@example.com",
 	}
@@ -50,8 +52,9 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	id, _ := utils.ParamInt(r, "id")
 	data := map[string]interface{}{
-		"id": 1,
+		"id": id,
 		"name": user["name"],
 		"email": user["email"],
 	}
@@ -60,9 +63,19 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 // DeleteUser deletes a user
 func DeleteUser(w http.ResponseWriter, r *http.Request) {
-	utils.SendResponse(w, true, "Foydalanuvchi o'chirildi", nil)
+	utils.SendResponse(w, true, "Foydalanuvchi o'chirildi", map[string]string{"id": utils.Param(r, "id")})
 }
 
+// UserController /api/users resursi: routes.APIResource uchun
+// index/store/show/update/destroy handlerlarini bog'laydi
+type UserController struct{}
+
+func (UserController) Index(w http.ResponseWriter, r *http.Request)   { GetUsers(w, r) }
+func (UserController) Store(w http.ResponseWriter, r *http.Request)   { CreateUser(w, r) }
+func (UserController) Show(w http.ResponseWriter, r *http.Request)    { GetUser(w, r) }
+func (UserController) Update(w http.ResponseWriter, r *http.Request)  { UpdateUser(w, r) }
+func (UserController) Destroy(w http.ResponseWriter, r *http.Request) { DeleteUser(w, r) }
+
 // GetAllUsers returns all users (admin)
 func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	users := []map[string]interface{}{
@@ -75,15 +88,61 @@ func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 
 // DeleteUserAdmin deletes a user (admin only)
 func DeleteUserAdmin(w http.ResponseWriter, r *http.Request) {
-	utils.SendResponse(w, true, "Foydalanuvchi admin tomonidan o'chirildi", nil)
+	utils.SendResponse(w, true, "Foydalanuvchi admin tomonidan o'chirildi", map[string]string{"id": utils.Param(r, "id")})
 }
 
-// AdminDashboard shows admin dashboard
+// AdminDashboard shows admin dashboard with live tunnel server state
 func AdminDashboard(w http.ResponseWriter, r *http.Request) {
 	data := map[string]interface{}{
-		"total_users": 3,
-		"total_requests": 1000,
 		"status": "online",
 	}
+
+	if total, err := services.CountUsers(); err == nil {
+		data["total_users"] = total
+	}
+
+	stats, err := services.FetchTunnelStats(r.Context())
+	if err != nil {
+		data["status"] = "offline"
+		data["tunnel_error"] = err.Error()
+	} else {
+		data["total_requests"] = stats.TotalStreams
+		data["tunnel"] = stats
+	}
 	utils.SendResponse(w, true, "Admin boshqaruvi paneli", data)
 }
+
+// AdminEvents streams live tunnel server events (SSE) to the admin panel
+func AdminEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, `{"error":"Streaming not supported"}`, http.StatusInternalServerError)
+		return
+	}
+
+	events, err := services.OpenTunnelEvents(r.Context())
+	if err != nil {
+		utils.SendStatusResponse(w, http.StatusBadGateway, false, "Tunnel server bilan bog'lanib bo'lmadi", map[string]string{"error": err.Error()})
+		return
+	}
+	defer events.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := events.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			flusher.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Package jwt signs and verifies compact JSON Web Tokens with HS256 and
+// EdDSA (Ed25519) keys, picked by the "kid" header so keys can be rotated
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Supported algorithms ("alg" header values)
+const (
+	HS256 = "HS256"
+	EdDSA = "EdDSA"
+)
+
+// Verification errors; Verifier.Verify wraps them with details
+var (
+	ErrMalformed      = errors.New("jwt: malformed token")
+	ErrUnsupportedAlg = errors.New("jwt: unsupported algorithm")
+	ErrUnknownKey     = errors.New("jwt: unknown key")
+	ErrSignature      = errors.New("jwt: bad signature")
+	ErrExpired        = errors.New("jwt: token expired")
+	ErrNotYetValid    = errors.New("jwt: token not valid yet")
+	ErrIssuer         = errors.New("jwt: wrong issuer")
+	ErrAudience       = errors.New("jwt: wrong audience")
+)
+
+// Claims are the registered claims this project uses, plus the private
+// "tunnels" claim; times are Unix seconds
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	// Tunnels are the tunnel names reserved by Subject when the token was
+	// issued, so tunnel servers without a database can authorize them
+	Tunnels []string `json:"tunnels,omitempty"`
+}
+
+// Audience is the "aud" claim, which is either a string or an array
+type Audience []string
+
+// MarshalJSON writes a single audience as a plain string
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// UnmarshalJSON accepts both forms of "aud"
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// Contains reports whether audience is one of a
+func (a Audience) Contains(audience string) bool {
+	for _, aud := range a {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+var encoding = base64.RawURLEncoding
+
+// IsJWT reports whether token has the header.payload.signature shape, which
+// tells it apart from the opaque hex tokens
+func IsJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// Sign returns the compact JWT of claims signed with key; the key's ID goes
+// into the "kid" header
+func Sign(claims Claims, key Key) (string, error) {
+	if !key.CanSign() {
+		return "", fmt.Errorf("jwt: key %q cannot sign", key.ID)
+	}
+	h, err := json.Marshal(header{Alg: key.Algorithm, Typ: "JWT", Kid: key.ID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := encoding.EncodeToString(h) + "." + encoding.EncodeToString(payload)
+
+	var signature []byte
+	switch key.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, key.Secret)
+		mac.Write([]byte(signingInput))
+		signature = mac.Sum(nil)
+	case EdDSA:
+		signature = ed25519.Sign(key.Private, []byte(signingInput))
+	}
+	return signingInput + "." + encoding.EncodeToString(signature), nil
+}
+
+// KeyFinder returns the verification key for a "kid"; KeySet and RemoteKeySet
+// implement it
+type KeyFinder interface {
+	Find(kid string) (Key, error)
+}
+
+// Verifier checks signature, expiry and, when set, issuer and audience
+type Verifier struct {
+	Keys     KeyFinder
+	Issuer   string
+	Audience string
+	// Leeway allows for clock skew between the issuer and this node
+	Leeway time.Duration
+	// Now is time.Now unless set
+	Now func() time.Time
+}
+
+// Verify returns the claims of a valid token. Tokens without "exp" are
+// rejected: a stateless token can't be revoked, so it must run out.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrMalformed, err)
+	}
+	if h.Alg != HS256 && h.Alg != EdDSA {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlg, h.Alg)
+	}
+	key, err := v.Keys.Find(h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	// The key decides the algorithm, never the token: an HS256 token must not
+	// be checked against an Ed25519 key or the other way round
+	if key.Algorithm != h.Alg {
+		return nil, fmt.Errorf("%w: key %q is %s, token says %s", ErrUnsupportedAlg, key.ID, key.Algorithm, h.Alg)
+	}
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrMalformed, err)
+	}
+	if !key.verify([]byte(parts[0]+"."+parts[1]), signature) {
+		return nil, ErrSignature
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrMalformed, err)
+	}
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	switch {
+	case claims.ExpiresAt == 0:
+		return nil, fmt.Errorf("%w: no exp claim", ErrMalformed)
+	case !now.Before(time.Unix(claims.ExpiresAt, 0).Add(v.Leeway)):
+		return nil, ErrExpired
+	case claims.NotBefore != 0 && now.Add(v.Leeway).Before(time.Unix(claims.NotBefore, 0)):
+		return nil, ErrNotYetValid
+	case v.Issuer != "" && claims.Issuer != v.Issuer:
+		return nil, fmt.Errorf("%w: %q", ErrIssuer, claims.Issuer)
+	case v.Audience != "" && !claims.Audience.Contains(v.Audience):
+		return nil, fmt.Errorf("%w: %q", ErrAudience, []string(claims.Audience))
+	}
+	return &claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := encoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
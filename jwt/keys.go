@@ -0,0 +1,325 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MinSecretSize is the shortest HS256 secret accepted (RFC 7518 asks for at
+// least the hash size)
+const MinSecretSize = sha256.Size
+
+// Key is one signing or verification key. HS256 keys have Secret; EdDSA keys
+// have Public, and Private too on nodes that sign.
+type Key struct {
+	ID        string
+	Algorithm string
+	Secret    []byte
+	Private   ed25519.PrivateKey
+	Public    ed25519.PublicKey
+}
+
+// CanSign reports whether the key holds the secret or private part
+func (k Key) CanSign() bool {
+	switch k.Algorithm {
+	case HS256:
+		return len(k.Secret) > 0
+	case EdDSA:
+		return len(k.Private) == ed25519.PrivateKeySize
+	}
+	return false
+}
+
+func (k Key) verify(input, signature []byte) bool {
+	switch k.Algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, k.Secret)
+		mac.Write(input)
+		return hmac.Equal(signature, mac.Sum(nil))
+	case EdDSA:
+		return len(k.Public) == ed25519.PublicKeySize && ed25519.Verify(k.Public, input, signature)
+	}
+	return false
+}
+
+// ParseKeys reads a comma separated list of kid:alg:base64 entries, e.g.
+// "2026-10:EdDSA:<seed>,legacy:HS256:<secret>". EdDSA values are a base64
+// ed25519 private key or its 32-byte seed, HS256 values the shared secret.
+func ParseKeys(spec string) ([]Key, error) {
+	var keys []Key
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("jwt key %q: expected kid:alg:base64", entry)
+		}
+		kid, alg := parts[0], parts[1]
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(parts[2]))
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", kid, err)
+		}
+
+		key := Key{ID: kid, Algorithm: alg}
+		switch alg {
+		case HS256:
+			if len(value) < MinSecretSize {
+				return nil, fmt.Errorf("jwt key %q: HS256 secret must be at least %d bytes", kid, MinSecretSize)
+			}
+			key.Secret = value
+		case EdDSA:
+			switch len(value) {
+			case ed25519.SeedSize:
+				key.Private = ed25519.NewKeyFromSeed(value)
+			case ed25519.PrivateKeySize:
+				key.Private = ed25519.PrivateKey(value)
+			default:
+				return nil, fmt.Errorf("jwt key %q: unexpected ed25519 key length %d", kid, len(value))
+			}
+			key.Public = key.Private.Public().(ed25519.PublicKey)
+		default:
+			return nil, fmt.Errorf("jwt key %q: %w %q", kid, ErrUnsupportedAlg, alg)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// KeySet holds the keys of this node by kid. Rotating means adding the new
+// key as the signing key and keeping the old one until its tokens expire.
+type KeySet struct {
+	keys    map[string]Key
+	order   []string
+	signing string
+}
+
+// NewKeySet builds a key set; signingID picks the signing key, empty means
+// the first key that can sign (none at all makes a verify-only set)
+func NewKeySet(keys []Key, signingID string) (*KeySet, error) {
+	set := &KeySet{keys: make(map[string]Key, len(keys))}
+	for _, key := range keys {
+		if _, ok := set.keys[key.ID]; ok {
+			return nil, fmt.Errorf("jwt: duplicate kid %q", key.ID)
+		}
+		set.keys[key.ID] = key
+		set.order = append(set.order, key.ID)
+		if signingID == "" && key.CanSign() {
+			signingID = key.ID
+		}
+	}
+	if signingID != "" {
+		key, ok := set.keys[signingID]
+		if !ok {
+			return nil, fmt.Errorf("jwt: signing key %q: %w", signingID, ErrUnknownKey)
+		}
+		if !key.CanSign() {
+			return nil, fmt.Errorf("jwt: key %q cannot sign", signingID)
+		}
+	}
+	set.signing = signingID
+	return set, nil
+}
+
+// Find implements KeyFinder
+func (s *KeySet) Find(kid string) (Key, error) {
+	key, ok := s.keys[kid]
+	if !ok {
+		return Key{}, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+// SigningKey returns the key new tokens are signed with
+func (s *KeySet) SigningKey() (Key, bool) {
+	key, ok := s.keys[s.signing]
+	return key, ok
+}
+
+// JWKS lists the public halves of the EdDSA keys. HS256 secrets are never
+// published; nodes verifying those need the secret itself.
+func (s *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	for _, kid := range s.order {
+		key := s.keys[kid]
+		if key.Algorithm != EdDSA {
+			continue
+		}
+		set.Keys = append(set.Keys, JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   encoding.EncodeToString(key.Public),
+			Kid: key.ID,
+			Alg: EdDSA,
+			Use: "sig",
+		})
+	}
+	return set
+}
+
+// JWKS is a JSON Web Key Set (RFC 7517)
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK is one public key of a JWKS; only Ed25519 (RFC 8037) keys are used
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+}
+
+// VerifyKeys returns the Ed25519 keys of the set, skipping key types this
+// package doesn't verify
+func (s JWKS) VerifyKeys() ([]Key, error) {
+	var keys []Key
+	for _, jwk := range s.Keys {
+		if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		public, err := encoding.DecodeString(jwk.X)
+		if err != nil || len(public) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("jwks key %q: bad x", jwk.Kid)
+		}
+		keys = append(keys, Key{ID: jwk.Kid, Algorithm: EdDSA, Public: ed25519.PublicKey(public)})
+	}
+	return keys, nil
+}
+
+// maxJWKSSize guards against reading something that is not a key set
+const maxJWKSSize = 1 << 20
+
+// RemoteKeySet verifies against the JWKS served at URL. Keys are fetched on
+// first use and again when a token names an unknown kid, at most once per
+// MinRefresh, so rotated keys are picked up without a restart. The fetch runs
+// outside the lock: known kids are served from the cache meanwhile and
+// concurrent lookups of unknown kids share one request.
+type RemoteKeySet struct {
+	URL        string
+	Client     *http.Client
+	MinRefresh time.Duration
+
+	mu       sync.Mutex
+	keys     map[string]Key
+	fetched  time.Time
+	inflight *keyFetch
+}
+
+// keyFetch is a JWKS request in progress; done is closed when it finishes
+type keyFetch struct {
+	done chan struct{}
+	err  error
+}
+
+// NewRemoteKeySet returns a RemoteKeySet with a 10s HTTP timeout that
+// refetches at most once a minute
+func NewRemoteKeySet(url string) *RemoteKeySet {
+	return &RemoteKeySet{
+		URL:        url,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		MinRefresh: time.Minute,
+	}
+}
+
+// Find implements KeyFinder
+func (s *RemoteKeySet) Find(kid string) (Key, error) {
+	s.mu.Lock()
+	if key, ok := s.keys[kid]; ok {
+		s.mu.Unlock()
+		return key, nil
+	}
+	call := s.inflight
+	if call == nil {
+		if !s.fetched.IsZero() && time.Since(s.fetched) < s.MinRefresh {
+			s.mu.Unlock()
+			return Key{}, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+		}
+		// Failed fetches count too, so a down issuer isn't hammered
+		s.fetched = time.Now()
+		call = &keyFetch{done: make(chan struct{})}
+		s.inflight = call
+		s.mu.Unlock()
+		s.refresh(call)
+	} else {
+		s.mu.Unlock()
+		<-call.done
+	}
+
+	s.mu.Lock()
+	key, ok := s.keys[kid]
+	s.mu.Unlock()
+	switch {
+	case ok:
+		return key, nil
+	case call.err != nil:
+		return Key{}, fmt.Errorf("jwks %s: %w", s.URL, call.err)
+	}
+	return Key{}, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+}
+
+// refresh runs call and swaps in the fetched keys; on error the cached keys
+// stay in use
+func (s *RemoteKeySet) refresh(call *keyFetch) {
+	keys, err := s.fetch()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		s.keys = make(map[string]Key, len(keys))
+		for _, key := range keys {
+			s.keys[key.ID] = key
+		}
+	}
+	call.err = err
+	s.inflight = nil
+	close(call.done)
+}
+
+func (s *RemoteKeySet) fetch() ([]Key, error) {
+	resp, err := s.Client.Get(s.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(resp.Status)
+	}
+	var set JWKS
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxJWKSSize)).Decode(&set); err != nil {
+		return nil, err
+	}
+	return set.VerifyKeys()
+}
+
+// KeyFinders looks a kid up in each finder in turn, e.g. the local HS256
+// secrets first and the issuer's JWKS second
+type KeyFinders []KeyFinder
+
+// Find implements KeyFinder
+func (f KeyFinders) Find(kid string) (Key, error) {
+	err := fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	for _, finder := range f {
+		key, findErr := finder.Find(kid)
+		if findErr == nil {
+			return key, nil
+		}
+		if !errors.Is(findErr, ErrUnknownKey) {
+			err = findErr
+		}
+	}
+	return Key{}, err
+}
@@ -5,16 +5,28 @@ import (
 	"net/http"
 	"os"
 
+	"go-tunnel/middleware"
 	"go-tunnel/routes"
 	"go-tunnel/services"
 )
 
 func main() {
-	services.ConnectDatabase()
-	
 	// Setup routes (Laravel-style)
 	router := routes.SetupRoutes()
 
+	// go run main.go routes:list [-json] [-fail-on-conflict]
+	if len(os.Args) > 1 && os.Args[1] == "routes:list" {
+		if err := routes.ListCommand(router, os.Args[2:], os.Stdout, os.Stderr); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	services.ConnectDatabase()
+	if err := services.InitJWT(); err != nil {
+		log.Fatalf("JWT: %v", err)
+	}
+
 	host := os.Getenv("APP_URL")
 	if host == "" {
 		host = "0.0.0.0:8080"
@@ -25,7 +37,10 @@ func main() {
 
 	// Serve static files for admin panel at /admin-panel/
 	http.Handle("/admin-panel/", http.StripPrefix("/admin-panel/", http.FileServer(http.Dir("./admin"))))
-	// Use the router as HTTP handler for all other routes
-	http.Handle("/", router)
+	// Release manifest and binaries for "mytunnel update" (build.go output)
+	http.Handle("/releases/", http.StripPrefix("/releases/", http.FileServer(http.Dir("./builds"))))
+	// Use the router as HTTP handler for all other routes; the router is a
+	// plain http.Handler, so standard middleware wraps it directly
+	http.Handle("/", middleware.RequestID(router))
 	log.Fatal(http.ListenAndServe(host, nil))
 }
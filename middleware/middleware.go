@@ -1,61 +1,140 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strings"
 	"time"
+
+	"go-tunnel/services"
+	"go-tunnel/utils"
 )
 
-// Handler type for middleware
-type Handler func(http.ResponseWriter, *http.Request)
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// newRequestID returns 16 random hex characters
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestID gives every request an ID: the client's X-Request-ID if it sent
+// one, otherwise a random one. It is echoed in the response and available to
+// handlers and later middleware as utils.RequestID(r).
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, utils.WithRequestID(r, id))
+	})
+}
 
 // LogRequest logs each HTTP request
-func LogRequest(next Handler) Handler {
-	return func(w http.ResponseWriter, r *http.Request) {
+func LogRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		
 		log.Printf(
-			"| %s | %s | %s | %v",
+			"| %s | %s | %s | %s | %v",
+			utils.RequestID(r),
 			r.Method,
 			r.URL.Path,
 			r.RemoteAddr,
 			time.Since(start),
 		)
 		
-		next(w, r)
-	}
+		next.ServeHTTP(w, r)
+	})
 }
 
-// CheckAuth checks if user is authenticated
-func CheckAuth(next Handler) Handler {
-	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("Authorization")
-		if token == "" {
-			http.Error(w, `{"error":"Unauthorized"}`, http.StatusUnauthorized)
+// CheckAuth authenticates "Authorization: Bearer <token>" against the
+// auth_tokens table and puts the user and the token in the request context
+// (utils.User, utils.AuthToken). Missing, malformed, unknown, expired and
+// revoked tokens get 401 JSON with a WWW-Authenticate challenge (RFC 6750).
+//
+// Signed JWTs (HS256, EdDSA) are verified by signature alone, without a
+// database query; for them utils.AuthToken is nil and utils.User only has
+// the ID.
+func CheckAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			unauthorized(w, "", "Authorization header required")
+			return
+		}
+		scheme, token, _ := strings.Cut(header, " ")
+		token = strings.TrimSpace(token)
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			unauthorized(w, "invalid_request", "Authorization header must be \"Bearer <token>\"")
+			return
+		}
+
+		user, authToken, err := services.AuthenticateToken(token)
+		switch {
+		case errors.Is(err, services.ErrTokenExpired):
+			unauthorized(w, "invalid_token", "Token expired")
+			return
+		case errors.Is(err, services.ErrTokenRevoked):
+			unauthorized(w, "invalid_token", "Token revoked")
+			return
+		case errors.Is(err, services.ErrInvalidToken):
+			unauthorized(w, "invalid_token", "Invalid token")
+			return
+		case err != nil:
+			log.Printf("CheckAuth: %s: %v", utils.RequestID(r), err)
+			http.Error(w, `{"error":"Internal server error"}`, http.StatusInternalServerError)
 			return
 		}
-		log.Printf("Auth token: %s", token)
-		next(w, r)
+		next.ServeHTTP(w, utils.WithAuthToken(utils.WithUser(r, user), authToken))
+	})
+}
+
+// unauthorized answers 401 with a Bearer challenge; code is the RFC 6750
+// error code, empty when no credentials were sent at all
+func unauthorized(w http.ResponseWriter, code, description string) {
+	challenge := `Bearer realm="api"`
+	if code != "" {
+		challenge += fmt.Sprintf(`, error=%q, error_description=%q`, code, description)
 	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	body := map[string]string{"error": "Unauthorized", "message": description}
+	if code != "" {
+		body["code"] = code
+	}
+	json.NewEncoder(w).Encode(body)
 }
 
 // CheckContentType checks if request has proper Content-Type
-func CheckContentType(contentType string) func(Handler) Handler {
-	return func(next Handler) Handler {
-		return func(w http.ResponseWriter, r *http.Request) {
+func CheckContentType(contentType string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.Header.Get("Content-Type") != contentType && r.Method != "GET" {
 				http.Error(w, `{"error":"Invalid Content-Type"}`, http.StatusBadRequest)
 				return
 			}
-			next(w, r)
-		}
+			next.ServeHTTP(w, r)
+		})
 	}
 }
 
 // CheckMethod ensures only specific HTTP methods are allowed
-func CheckMethod(allowedMethods ...string) func(Handler) Handler {
-	return func(next Handler) Handler {
-		return func(w http.ResponseWriter, r *http.Request) {
+func CheckMethod(allowedMethods ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			allowed := false
 			for _, method := range allowedMethods {
 				if r.Method == method {
@@ -67,70 +146,77 @@ func CheckMethod(allowedMethods ...string) func(Handler) Handler {
 				http.Error(w, `{"error":"Method not allowed"}`, http.StatusMethodNotAllowed)
 				return
 			}
-			next(w, r)
-		}
+			next.ServeHTTP(w, r)
+		})
 	}
 }
 
 // SetHeaders adds custom headers to response
-func SetHeaders(headers map[string]string) func(Handler) Handler {
-	return func(next Handler) Handler {
-		return func(w http.ResponseWriter, r *http.Request) {
+func SetHeaders(headers map[string]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			for key, value := range headers {
 				w.Header().Set(key, value)
 			}
-			next(w, r)
-		}
+			next.ServeHTTP(w, r)
+		})
 	}
 }
 
-// AdminOnly checks if user is admin
-func AdminOnly(next Handler) Handler {
-	return func(w http.ResponseWriter, r *http.Request) {
+// AdminOnly lets a request through only if its X-Admin-Token header equals
+// the ADMIN_TOKEN secret; without ADMIN_TOKEN every admin route is closed
+func AdminOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret := os.Getenv("ADMIN_TOKEN")
 		adminToken := r.Header.Get("X-Admin-Token")
-		if adminToken == "" {
+		if secret == "" || subtle.ConstantTimeCompare([]byte(adminToken), []byte(secret)) != 1 {
 			http.Error(w, `{"error":"Admin access required"}`, http.StatusForbidden)
 			return
 		}
-		next(w, r)
-	}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // RateLimit is a simple rate limiting middleware
-func RateLimit(requestsPerSecond int) func(Handler) Handler {
-	return func(next Handler) Handler {
-		return func(w http.ResponseWriter, r *http.Request) {
+func RateLimit(requestsPerSecond int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			log.Printf("Rate limit check: %d req/sec", requestsPerSecond)
-			next(w, r)
-		}
+			next.ServeHTTP(w, r)
+		})
 	}
 }
 
-// CORS enables CORS headers
-func CORS(next Handler) Handler {
-	return func(w http.ResponseWriter, r *http.Request) {
+// CORS enables CORS headers. Preflight requests are answered with the
+// methods in the Allow header when the router has set it.
+func CORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods := w.Header().Get("Allow")
+		if methods == "" {
+			methods = "GET, POST, PUT, DELETE, PATCH, OPTIONS"
+		}
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, PATCH, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", methods)
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 		
 		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 		
-		next(w, r)
-	}
+		next.ServeHTTP(w, r)
+	})
 }
 
 // ErrorHandler wraps handler with error recovery
-func ErrorHandler(next Handler) Handler {
-	return func(w http.ResponseWriter, r *http.Request) {
+func ErrorHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
 				log.Printf("Error: %v", err)
 				http.Error(w, `{"error":"Internal server error"}`, http.StatusInternalServerError)
 			}
 		}()
-		next(w, r)
-	}
+		next.ServeHTTP(w, r)
+	})
 }
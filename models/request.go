@@ -4,3 +4,24 @@ type LoginRequest struct {
     Email    string `json:"email"`
     Password string `json:"password"`
 }
+
+// RegisterRequest is the body of POST /auth/register; name is optional
+type RegisterRequest struct {
+    Name     string `json:"name,omitempty"`
+    Email    string `json:"email"`
+    Password string `json:"password"`
+}
+
+// RefreshRequest is the body of POST /auth/refresh
+type RefreshRequest struct {
+    RefreshToken string `json:"refresh_token"`
+}
+
+type ReserveDomainRequest struct {
+    Name string `json:"name"`
+}
+
+type CustomDomainRequest struct {
+    Domain string `json:"domain"`
+    Tunnel string `json:"tunnel,omitempty"`
+}
@@ -1,7 +1,21 @@
 package models
 
+import "time"
+
 type Response struct {
     Success bool        `json:"success"`
     Message string      `json:"message"`
     Data    interface{} `json:"data,omitempty"`
 }
+
+// TokenResponse is the data of a successful login or refresh
+type TokenResponse struct {
+    Token            string    `json:"token"`
+    TokenType        string    `json:"token_type"`
+    ExpiresAt        time.Time `json:"expires_at"`
+    RefreshToken     string    `json:"refresh_token"`
+    RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+    // JWT is a stateless access token, set when the API has a JWT signing key
+    JWT              string    `json:"jwt,omitempty"`
+    User             *User     `json:"user,omitempty"`
+}
@@ -0,0 +1,54 @@
+package models
+
+import "time"
+
+// ReservedDomain is a tunnel name (alice.<tunnel-domain>) owned by a user
+type ReservedDomain struct {
+    ID        uint      `json:"id" gorm:"primaryKey"`
+    UserID    uint      `json:"user_id"`
+    Name      string    `json:"name"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName tells GORM which table ReservedDomain lives in
+func (ReservedDomain) TableName() string {
+    return "reserved_domains"
+}
+
+// CustomDomain is a customer domain (dev.customer.com) routed to a reserved tunnel
+// once its DNS records are verified
+type CustomDomain struct {
+    ID                uint           `json:"id" gorm:"primaryKey"`
+    UserID            uint           `json:"user_id"`
+    ReservedDomainID  uint           `json:"reserved_domain_id"`
+    ReservedDomain    ReservedDomain `json:"tunnel" gorm:"foreignKey:ReservedDomainID"`
+    Domain            string         `json:"domain"`
+    VerificationToken string         `json:"verification_token"`
+    VerifiedAt        *time.Time     `json:"verified_at"`
+    CreatedAt         time.Time      `json:"created_at"`
+    UpdatedAt         time.Time      `json:"updated_at"`
+}
+
+// TableName tells GORM which table CustomDomain lives in
+func (CustomDomain) TableName() string {
+    return "custom_domains"
+}
+
+// TunnelSession records which tunnel server node holds a tunnel's control
+// connections, so cluster nodes can forward public connections to it
+type TunnelSession struct {
+    ID        uint      `json:"id" gorm:"primaryKey"`
+    Name      string    `json:"name"`
+    NodeID    string    `json:"node_id"`
+    NodeAddr  string    `json:"node_addr"`
+    // Owner is the hashed client session that holds the name cluster-wide
+    Owner     string    `json:"-"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName tells GORM which table TunnelSession lives in
+func (TunnelSession) TableName() string {
+    return "tunnel_sessions"
+}
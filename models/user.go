@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// User is an account from the users table; Password holds the hash and is
+// never written to JSON
+type User struct {
+    ID        uint      `json:"id" gorm:"primaryKey"`
+    Name      string    `json:"name"`
+    Email     string    `json:"email"`
+    Password  string    `json:"-"`
+    CreatedAt time.Time `json:"created_at"`
+    UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName tells GORM which table User lives in
+func (User) TableName() string {
+    return "users"
+}
+
+// Token kinds: access tokens authenticate requests, refresh tokens are only
+// exchanged for a new pair at /auth/refresh
+const (
+    TokenKindAccess  = "access"
+    TokenKindRefresh = "refresh"
+)
+
+// AuthToken is an API token sent as "Authorization: Bearer <token>"; it stops
+// working when it expires or is revoked. The tokens issued by one login and
+// its refreshes share a FamilyID. Only the SHA-256 of the token is stored, so
+// a leaked table can't be replayed; Value holds the token itself right after
+// it is issued.
+type AuthToken struct {
+    ID        uint       `json:"id" gorm:"primaryKey"`
+    UserID    uint       `json:"user_id"`
+    Token     string     `json:"-"` // hex SHA-256 of Value
+    Value     string     `json:"-" gorm:"-"`
+    Kind      string     `json:"kind"`
+    FamilyID  *string    `json:"family_id"`
+    ExpiresAt time.Time  `json:"expires_at"`
+    UsedAt    *time.Time `json:"used_at"`
+    RevokedAt *time.Time `json:"revoked_at"`
+    CreatedAt time.Time  `json:"created_at"`
+    UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// TableName tells GORM which table AuthToken lives in
+func (AuthToken) TableName() string {
+    return "auth_tokens"
+}
@@ -0,0 +1,116 @@
+package release
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// maxManifestSize guards against reading something that is not a manifest
+const maxManifestSize = 1 << 20
+
+var httpClient = &http.Client{Timeout: 5 * time.Minute}
+
+// isURL reports whether source is an http(s) address rather than a path
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// Open opens a manifest, signature or artifact from a local path, a file://
+// URL or an http(s) URL
+func Open(source string) (io.ReadCloser, error) {
+	if !isURL(source) {
+		return os.Open(strings.TrimPrefix(source, "file://"))
+	}
+
+	resp, err := httpClient.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", source, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// FetchManifest reads and verifies the manifest at source and its signature
+// at source + SignatureSuffix
+func FetchManifest(source string, key ed25519.PublicKey) (*Manifest, error) {
+	manifest, err := readAll(source)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := readAll(source + SignatureSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+	return Verify(manifest, signature, key)
+}
+
+func readAll(source string) ([]byte, error) {
+	r, err := Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(io.LimitReader(r, maxManifestSize))
+}
+
+// Resolve returns the location of ref (an artifact File) relative to the
+// manifest source
+func Resolve(source, ref string) string {
+	if isURL(ref) {
+		return ref
+	}
+	if isURL(source) {
+		base, err := url.Parse(source)
+		if err != nil {
+			return ref
+		}
+		rel, err := url.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		return base.ResolveReference(rel).String()
+	}
+	if filepath.IsAbs(ref) {
+		return ref
+	}
+	return filepath.Join(filepath.Dir(strings.TrimPrefix(source, "file://")), filepath.FromSlash(ref))
+}
+
+// Download copies the artifact into w, failing if its size or SHA-256 do not
+// match the manifest
+func Download(source string, artifact *Artifact, w io.Writer) error {
+	r, err := Open(Resolve(source, artifact.File))
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	hash := sha256.New()
+	limit := artifact.Size + 1
+	if artifact.Size <= 0 {
+		limit = 1 << 30
+	}
+	n, err := io.Copy(io.MultiWriter(w, hash), io.LimitReader(r, limit))
+	if err != nil {
+		return err
+	}
+	if artifact.Size > 0 && n != artifact.Size {
+		return fmt.Errorf("%s: size %d, manifest says %d", artifact.File, n, artifact.Size)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); !strings.EqualFold(sum, artifact.SHA256) {
+		return fmt.Errorf("%s: checksum mismatch (sha256 %s, manifest says %s)", artifact.File, sum, artifact.SHA256)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// Package release describes published mytunnel builds: the signed manifest
+// produced by build.go and consumed by "mytunnel update".
+package release
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Manifest lists the artifacts of one release. It is published as
+// manifest.json next to the binaries, with a detached ed25519 signature of
+// the exact file bytes in manifest.json.sig (base64).
+type Manifest struct {
+	Version   string     `json:"version"`
+	Commit    string     `json:"commit,omitempty"`
+	Date      string     `json:"date,omitempty"`
+	Artifacts []Artifact `json:"artifacts"`
+}
+
+// Artifact is one binary for one platform
+type Artifact struct {
+	// Name is the program: "client" or "server"
+	Name string `json:"name"`
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+	// File is the binary path relative to the manifest (or an absolute URL)
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	// Archive is the packaged binary for manual downloads, optional
+	Archive       string `json:"archive,omitempty"`
+	ArchiveSHA256 string `json:"archive_sha256,omitempty"`
+}
+
+// SignatureSuffix is appended to the manifest location to find its signature
+const SignatureSuffix = ".sig"
+
+// ErrBadSignature is returned when the manifest was not signed by the key
+var ErrBadSignature = errors.New("release manifest signature is invalid")
+
+// Find returns the artifact of program name for goos/goarch
+func (m *Manifest) Find(name, goos, goarch string) (*Artifact, bool) {
+	for i := range m.Artifacts {
+		a := &m.Artifacts[i]
+		if a.Name == name && a.OS == goos && a.Arch == goarch {
+			return a, true
+		}
+	}
+	return nil, false
+}
+
+// ParsePublicKey decodes a base64 ed25519 public key
+func ParsePublicKey(encoded string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("public key: expected %d bytes, got %d", ed25519.PublicKeySize, len(key))
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// ParsePrivateKey decodes a base64 ed25519 private key (or its 32-byte seed)
+func ParsePrivateKey(encoded string) (ed25519.PrivateKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("private key: %w", err)
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	}
+	return nil, fmt.Errorf("private key: unexpected length %d", len(key))
+}
+
+// Sign returns the base64 signature file contents for manifest bytes
+func Sign(manifest []byte, key ed25519.PrivateKey) []byte {
+	signature := ed25519.Sign(key, manifest)
+	return []byte(base64.StdEncoding.EncodeToString(signature) + "\n")
+}
+
+// Verify checks the signature file contents against manifest bytes and
+// decodes the manifest
+func Verify(manifest, signature []byte, key ed25519.PublicKey) (*Manifest, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || !ed25519.Verify(key, manifest, decoded) {
+		return nil, ErrBadSignature
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return nil, fmt.Errorf("release manifest: %w", err)
+	}
+	if m.Version == "" {
+		return nil, errors.New("release manifest: missing version")
+	}
+	return &m, nil
+}
+
+// CompareVersions compares "v1.2.3" style versions numerically, ignoring a
+// "-suffix". Unparsable versions such as "dev" sort before every release.
+func CompareVersions(a, b string) int {
+	pa, okA := parseVersion(a)
+	pb, okB := parseVersion(b)
+	switch {
+	case !okA && !okB:
+		return strings.Compare(a, b)
+	case !okA:
+		return -1
+	case !okB:
+		return 1
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func parseVersion(v string) ([]int, bool) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	if v == "" {
+		return nil, false
+	}
+	var parts []int
+	for _, field := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, false
+		}
+		parts = append(parts, n)
+	}
+	return parts, true
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+// docsPage is a self-contained API docs UI (no CDN) that renders the
+// OpenAPI document and can send requests to the API
+//
+//go:embed docs.html
+var docsPage string
+
+var docsTemplate = template.Must(template.New("docs").Parse(docsPage))
+
+// DocsHandler serves the docs UI for the OpenAPI document at specURL
+func DocsHandler(specURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		docsTemplate.Execute(w, specURL)
+	}
+}
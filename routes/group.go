@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RouteGroup represents a group of routes with shared prefix and middleware.
+// Routes are registered on the router as soon as they are declared, with the
+// prefixes and middleware of every enclosing group.
+type RouteGroup struct {
+	router     *Router
+	prefix     string
+	middleware []Middleware
+}
+
+// Group creates a nested group: prefixes are joined and the middleware runs
+// after the middleware of the enclosing groups
+func (rg *RouteGroup) Group(prefix string, groupFunc func(group *RouteGroup), middleware ...Middleware) *RouteGroup {
+	group := &RouteGroup{
+		router:     rg.router,
+		prefix:     joinPaths(rg.prefix, prefix),
+		middleware: rg.with(middleware),
+	}
+	groupFunc(group)
+	return group
+}
+
+func (rg *RouteGroup) GET(path string, handler http.HandlerFunc, middleware ...Middleware) *Route {
+	return rg.add("GET", path, handler, middleware)
+}
+
+func (rg *RouteGroup) POST(path string, handler http.HandlerFunc, middleware ...Middleware) *Route {
+	return rg.add("POST", path, handler, middleware)
+}
+
+func (rg *RouteGroup) PUT(path string, handler http.HandlerFunc, middleware ...Middleware) *Route {
+	return rg.add("PUT", path, handler, middleware)
+}
+
+func (rg *RouteGroup) DELETE(path string, handler http.HandlerFunc, middleware ...Middleware) *Route {
+	return rg.add("DELETE", path, handler, middleware)
+}
+
+func (rg *RouteGroup) PATCH(path string, handler http.HandlerFunc, middleware ...Middleware) *Route {
+	return rg.add("PATCH", path, handler, middleware)
+}
+
+// Any registers a route in the group for any HTTP method
+func (rg *RouteGroup) Any(path string, handler http.HandlerFunc, middleware ...Middleware) RouteList {
+	return rg.Match(anyMethods, path, handler, middleware...)
+}
+
+// Match registers a route in the group for the given HTTP methods
+func (rg *RouteGroup) Match(methods []string, path string, handler http.HandlerFunc, middleware ...Middleware) RouteList {
+	routes := make(RouteList, 0, len(methods))
+	for _, method := range methods {
+		routes = append(routes, rg.add(strings.ToUpper(method), path, handler, middleware))
+	}
+	return routes
+}
+
+func (rg *RouteGroup) add(method, path string, handler http.HandlerFunc, middleware []Middleware) *Route {
+	return rg.router.addRoute(method, joinPaths(rg.prefix, path), handler, rg.with(middleware)...)
+}
+
+// with returns the group middleware followed by extra in a new slice, so
+// routes and nested groups never share a backing array
+func (rg *RouteGroup) with(extra []Middleware) []Middleware {
+	all := make([]Middleware, 0, len(rg.middleware)+len(extra))
+	all = append(all, rg.middleware...)
+	return append(all, extra...)
+}
+
+// joinPaths joins a group prefix and a route path: ("/api", "/users") is
+// "/api/users" and ("/api", "/") is "/api"
+func joinPaths(prefix, path string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+	path = strings.Trim(path, "/")
+	if path == "" {
+		if prefix == "" {
+			return "/"
+		}
+		return prefix
+	}
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + path
+}
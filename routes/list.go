@@ -0,0 +1,183 @@
+package routes
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+)
+
+// RouteInfo is one row of the route table
+type RouteInfo struct {
+	Method     string   `json:"method"`
+	Path       string   `json:"path"`
+	Name       string   `json:"name,omitempty"`
+	Handler    string   `json:"handler"`
+	Middleware []string `json:"middleware"`
+}
+
+// Conflict is a route that can never match because an earlier route with
+// the same method has an equivalent path (param names aside)
+type Conflict struct {
+	Route    RouteInfo `json:"route"`
+	Shadowed RouteInfo `json:"shadowed"`
+}
+
+// Table describes the registered routes in registration order
+func (r *Router) Table() []RouteInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	table := make([]RouteInfo, len(r.routes))
+	for i, route := range r.routes {
+		table[i] = route.info()
+	}
+	return table
+}
+
+// Conflicts lists the routes shadowed by an earlier registration. The router
+// keeps the first route, so a conflict is always a dead route.
+func (r *Router) Conflicts() []Conflict {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var conflicts []Conflict
+	first := map[string]*Route{}
+	for _, route := range r.routes {
+		key := route.Method + " " + route.pattern.key()
+		if kept, ok := first[key]; ok {
+			conflicts = append(conflicts, Conflict{Route: kept.info(), Shadowed: route.info()})
+		} else {
+			first[key] = route
+		}
+	}
+	return conflicts
+}
+
+func (route *Route) info() RouteInfo {
+	middleware := append([]string{}, route.middlewareNames...)
+	handler := route.handlerName
+	if handler == "" {
+		handler = funcName(route.Handler)
+	}
+	return RouteInfo{
+		Method:     route.Method,
+		Path:       route.Path,
+		Name:       route.name,
+		Handler:    handler,
+		Middleware: middleware,
+	}
+}
+
+// key is the pattern with param names dropped: /users/{id:int} and
+// /users/{user:int} both give /users/{^(?:[0-9]+)$}, so they conflict
+func (p *pattern) key() string {
+	var b strings.Builder
+	for _, seg := range p.segments {
+		b.WriteByte('/')
+		switch seg.kind {
+		case staticSegment:
+			b.WriteString(seg.value)
+		case wildcardSegment:
+			b.WriteString("{...}")
+		default:
+			b.WriteByte('{')
+			if seg.match != nil {
+				b.WriteString(seg.match.String())
+			}
+			b.WriteByte('}')
+		}
+	}
+	return b.String()
+}
+
+// closureSuffix matches what the compiler appends to closures and method
+// values: CheckAuth.func1, CheckContentType.func1.1, UserController.Index-fm
+var closureSuffix = regexp.MustCompile(`(\.func\d+(\.\d+)*|-fm)$`)
+
+// funcName is the short name of a function, like handlers.GetUser
+func funcName(fn interface{}) string {
+	v := reflect.ValueOf(fn)
+	if !v.IsValid() || (v.Kind() == reflect.Func && v.IsNil()) {
+		return "-"
+	}
+	if v.Kind() != reflect.Func {
+		// An http.Handler implemented by a type, e.g. *http.ServeMux
+		return v.Type().String()
+	}
+	f := runtime.FuncForPC(v.Pointer())
+	if f == nil {
+		return "?"
+	}
+	name := closureSuffix.ReplaceAllString(f.Name(), "")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
+
+// middlewareName names a middleware by the handler it returned, since that
+// is the function worth showing: middleware.CheckAuth returns CheckAuth.func1
+// and middleware.CheckContentType(...) returns CheckContentType.func1.1
+func middlewareName(m Middleware, wrapped http.Handler) string {
+	if wrapped != nil {
+		return funcName(wrapped)
+	}
+	return funcName(m)
+}
+
+// ListCommand implements "routes:list": it prints the route table as text
+// or JSON and reports routes shadowed by earlier ones
+func ListCommand(router *Router, args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("routes:list", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	asJSON := fs.Bool("json", false, "print routes as JSON")
+	failOnConflict := fs.Bool("fail-on-conflict", false, "exit with an error if two routes conflict")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	table := router.Table()
+	conflicts := router.Conflicts()
+
+	if *asJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(struct {
+			Routes    []RouteInfo `json:"routes"`
+			Conflicts []Conflict  `json:"conflicts"`
+		}{table, append([]Conflict{}, conflicts...)}); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "METHOD\tPATH\tNAME\tHANDLER\tMIDDLEWARE")
+		for _, route := range table {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", route.Method, route.Path, dash(route.Name),
+				route.Handler, dash(strings.Join(route.Middleware, " > ")))
+		}
+		w.Flush()
+		fmt.Fprintf(stdout, "\n%d routes\n", len(table))
+	}
+
+	for _, c := range conflicts {
+		fmt.Fprintf(stderr, "conflict: %s %s (%s) is shadowed by %s %s (%s)\n",
+			c.Shadowed.Method, c.Shadowed.Path, c.Shadowed.Handler,
+			c.Route.Method, c.Route.Path, c.Route.Handler)
+	}
+	if *failOnConflict && len(conflicts) > 0 {
+		return fmt.Errorf("%d route conflicts found", len(conflicts))
+	}
+	return nil
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
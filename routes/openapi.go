@@ -0,0 +1,359 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenAPIInfo configures the document built by Router.OpenAPI
+type OpenAPIInfo struct {
+	Title       string
+	Version     string
+	Description string
+
+	// SecuritySchemes are the components.securitySchemes entries and
+	// MiddlewareSecurity maps a middleware name, as routes:list shows it,
+	// to the scheme it enforces: routes using that middleware require it
+	SecuritySchemes    map[string]SecurityScheme
+	MiddlewareSecurity map[string]string
+}
+
+// SecurityScheme is an OpenAPI security scheme, e.g. bearer tokens or an
+// API key header
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+type openAPIDocument struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       openAPIInfo                      `json:"info"`
+	Paths      map[string]map[string]*operation `json:"paths"`
+	Components components                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type components struct {
+	Schemas         map[string]*schema        `json:"schemas,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []parameter           `json:"parameters,omitempty"`
+	RequestBody *requestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Required    bool    `json:"required"`
+	Description string  `json:"description,omitempty"`
+	Schema      *schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *schema `json:"schema"`
+}
+
+type schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+}
+
+// OpenAPI builds an OpenAPI 3 document from the registered routes: paths and
+// params come from the patterns, bodies from Request/Response, security from
+// the middleware. HEAD and OPTIONS are answered by the router and left out.
+func (r *Router) OpenAPI(info OpenAPIInfo) ([]byte, error) {
+	doc := openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info:    openAPIInfo{Title: info.Title, Version: info.Version, Description: info.Description},
+		Paths:   map[string]map[string]*operation{},
+	}
+	schemas := newSchemaBuilder()
+	operationIDs := map[string]bool{}
+
+	routes := r.ListRoutes()
+	for i := range routes {
+		route := &routes[i]
+		if route.Method == http.MethodHead || route.Method == http.MethodOptions {
+			continue
+		}
+		path, params := openAPIPath(route.pattern)
+		ops, ok := doc.Paths[path]
+		if !ok {
+			ops = map[string]*operation{}
+			doc.Paths[path] = ops
+		}
+		method := strings.ToLower(route.Method)
+		if _, ok := ops[method]; ok {
+			// Shadowed route, see Router.Conflicts
+			continue
+		}
+		ops[method] = route.operation(method, path, params, schemas, info, operationIDs)
+	}
+
+	doc.Components.Schemas = schemas.schemas
+	doc.Components.SecuritySchemes = info.SecuritySchemes
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// OpenAPIHandler serves the document as JSON; it is built per request, so
+// routes added after startup show up too
+func (r *Router) OpenAPIHandler(info OpenAPIInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		spec, err := r.OpenAPI(info)
+		if err != nil {
+			http.Error(w, `{"error":"OpenAPI document could not be built"}`, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(spec)
+	}
+}
+
+func (route *Route) operation(method, path string, params []parameter, schemas *schemaBuilder,
+	info OpenAPIInfo, operationIDs map[string]bool) *operation {
+	op := &operation{
+		Summary:    route.summary,
+		Parameters: params,
+		Responses:  map[string]response{},
+	}
+
+	// PUT and PATCH of a resource share a name, but operation ids are unique
+	op.OperationID = route.name
+	if op.OperationID == "" || operationIDs[op.OperationID] {
+		op.OperationID = method + strings.NewReplacer("/", "_", "{", "", "}", "").Replace(path)
+		if route.name != "" {
+			op.OperationID = route.name + "." + method
+		}
+	}
+	operationIDs[op.OperationID] = true
+
+	if i := strings.LastIndex(route.name, "."); i > 0 {
+		op.Tags = []string{route.name[:i]}
+	}
+
+	if route.request != nil {
+		op.RequestBody = &requestBody{
+			Required: true,
+			Content:  map[string]mediaType{"application/json": {Schema: schemas.schemaFor(route.request)}},
+		}
+	}
+
+	ok := response{Description: "OK"}
+	if route.response != nil {
+		ok.Content = map[string]mediaType{"application/json": {Schema: schemas.schemaFor(route.response)}}
+	}
+	op.Responses["200"] = ok
+
+	requirement := map[string][]string{}
+	for _, name := range route.middlewareNames {
+		if scheme, ok := info.MiddlewareSecurity[name]; ok {
+			requirement[scheme] = []string{}
+		}
+	}
+	if len(requirement) > 0 {
+		op.Security = []map[string][]string{requirement}
+		op.Responses["401"] = response{Description: "Unauthorized"}
+	}
+	return op
+}
+
+// openAPIPath turns /users/{id:int}/files/{path...} into
+// /users/{id}/files/{path} and describes its params
+func openAPIPath(p *pattern) (string, []parameter) {
+	var b strings.Builder
+	var params []parameter
+	for _, seg := range p.segments {
+		b.WriteByte('/')
+		if seg.kind == staticSegment {
+			b.WriteString(seg.value)
+			continue
+		}
+		b.WriteString("{" + seg.value + "}")
+
+		param := parameter{Name: seg.value, In: "path", Required: true, Schema: &schema{Type: "string"}}
+		switch {
+		case seg.kind == wildcardSegment:
+			param.Description = "Rest of the path, may contain /"
+		case seg.match == constraints["int"]:
+			param.Schema = &schema{Type: "integer"}
+		case seg.match != nil:
+			param.Schema.Pattern = seg.match.String()
+		}
+		params = append(params, param)
+	}
+	return b.String(), params
+}
+
+// schemaBuilder turns Go types into JSON schemas; named structs go to
+// components.schemas and are referenced by $ref
+type schemaBuilder struct {
+	schemas map[string]*schema
+	names   map[reflect.Type]string
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{schemas: map[string]*schema{}, names: map[reflect.Type]string{}}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (b *schemaBuilder) schemaFor(t reflect.Type) *schema {
+	if t.Kind() == reflect.Pointer {
+		s := b.schemaFor(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	}
+
+	switch t {
+	case timeType:
+		return &schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json writes []byte as base64
+			return &schema{Type: "string", Format: "byte"}
+		}
+		return &schema{Type: "array", Items: b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: b.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		return &schema{Ref: "#/components/schemas/" + b.define(t)}
+	}
+	// interface{} and anything JSON can't describe better: any value
+	return &schema{}
+}
+
+// define adds a named struct to components.schemas once and returns its name;
+// models.Response is "Response", a second Response type gets its package
+func (b *schemaBuilder) define(t reflect.Type) string {
+	if name, ok := b.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := b.schemas[name]; taken {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+	// Registered before the fields so recursive types end in a $ref
+	b.names[t] = name
+	b.schemas[name] = &schema{}
+	*b.schemas[name] = *b.structSchema(t)
+	return name
+}
+
+// structSchema follows encoding/json: json tags name the fields, "-" skips
+// them, untagged embedded structs are inlined and fields without omitempty
+// are required
+func (b *schemaBuilder) structSchema(t reflect.Type) *schema {
+	s := &schema{Type: "object", Properties: map[string]*schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inner := b.structSchema(embedded)
+				for prop, ps := range inner.Properties {
+					s.Properties[prop] = ps
+				}
+				s.Required = append(s.Required, inner.Required...)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		fs := b.schemaFor(field.Type)
+		if hasOption(opts, "string") {
+			fs = &schema{Type: "string"}
+		}
+		s.Properties[name] = fs
+		if !hasOption(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+func hasOption(opts, option string) bool {
+	for _, opt := range strings.Split(opts, ",") {
+		if opt == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// segmentKind orders segments by specificity: static beats param beats wildcard
+type segmentKind int
+
+const (
+	staticSegment segmentKind = iota
+	paramSegment
+	wildcardSegment
+)
+
+// constraints are the named types usable as {name:type}
+var constraints = map[string]*regexp.Regexp{
+	"int":   regexp.MustCompile(`^[0-9]+$`),
+	"alpha": regexp.MustCompile(`^[a-zA-Z]+$`),
+	"alnum": regexp.MustCompile(`^[a-zA-Z0-9]+$`),
+	"slug":  regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`),
+	"uuid":  regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`),
+}
+
+// segment is one "/"-separated part of a route pattern
+type segment struct {
+	kind  segmentKind
+	value string         // static text or param name
+	match *regexp.Regexp // param constraint, nil for any value
+}
+
+// pattern is a parsed route path like /users/{id:int}/files/{path...}
+type pattern struct {
+	raw      string
+	segments []segment
+}
+
+// parsePattern parses a route path. Params are written {name}, {name:type}
+// (int, alpha, alnum, slug, uuid or a regular expression) and the last
+// segment may be a wildcard {name...} that matches the rest of the path.
+func parsePattern(path string) (*pattern, error) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("route %q: path must start with /", path)
+	}
+
+	p := &pattern{raw: path}
+	names := map[string]bool{}
+	parts := splitPath(path)
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			if strings.ContainsAny(part, "{}") {
+				return nil, fmt.Errorf("route %q: params must be a whole segment: %q", path, part)
+			}
+			p.segments = append(p.segments, segment{kind: staticSegment, value: part})
+			continue
+		}
+
+		inner := part[1 : len(part)-1]
+		if name, ok := strings.CutSuffix(inner, "..."); ok {
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("route %q: wildcard {%s...} must be the last segment", path, name)
+			}
+			if err := addName(names, path, name); err != nil {
+				return nil, err
+			}
+			p.segments = append(p.segments, segment{kind: wildcardSegment, value: name})
+			continue
+		}
+
+		name, constraint, _ := strings.Cut(inner, ":")
+		if err := addName(names, path, name); err != nil {
+			return nil, err
+		}
+		seg := segment{kind: paramSegment, value: name}
+		if constraint != "" {
+			match, err := compileConstraint(constraint)
+			if err != nil {
+				return nil, fmt.Errorf("route %q: param %q: %w", path, name, err)
+			}
+			seg.match = match
+		}
+		p.segments = append(p.segments, seg)
+	}
+	return p, nil
+}
+
+func addName(names map[string]bool, path, name string) error {
+	if name == "" {
+		return fmt.Errorf("route %q: empty param name", path)
+	}
+	if names[name] {
+		return fmt.Errorf("route %q: duplicate param %q", path, name)
+	}
+	names[name] = true
+	return nil
+}
+
+// compileConstraint resolves a named type or compiles a regular expression
+// that must match the whole segment
+func compileConstraint(constraint string) (*regexp.Regexp, error) {
+	if match, ok := constraints[constraint]; ok {
+		return match, nil
+	}
+	return regexp.Compile("^(?:" + constraint + ")$")
+}
+
+// splitPath splits /a/b/c into [a b c]; "/" is a single empty segment so the
+// root route has something to match
+func splitPath(path string) []string {
+	return strings.Split(strings.TrimPrefix(path, "/"), "/")
+}
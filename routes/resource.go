@@ -0,0 +1,194 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// APIController handles the conventional actions of a JSON resource
+type APIController interface {
+	Index(w http.ResponseWriter, r *http.Request)   // GET    /users
+	Store(w http.ResponseWriter, r *http.Request)   // POST   /users
+	Show(w http.ResponseWriter, r *http.Request)    // GET    /users/{id}
+	Update(w http.ResponseWriter, r *http.Request)  // PUT    /users/{id} (and PATCH)
+	Destroy(w http.ResponseWriter, r *http.Request) // DELETE /users/{id}
+}
+
+// ResourceController adds the form pages of a resource rendered as HTML
+type ResourceController interface {
+	APIController
+	Create(w http.ResponseWriter, r *http.Request) // GET /users/create
+	Edit(w http.ResponseWriter, r *http.Request)   // GET /users/{id}/edit
+}
+
+// resourceAction is one conventional route of a resource
+type resourceAction struct {
+	name    string
+	methods []string
+	path    string // appended to the resource path, {id} is the param
+}
+
+var resourceActions = []resourceAction{
+	{"index", []string{"GET"}, ""},
+	{"create", []string{"GET"}, "/create"},
+	{"store", []string{"POST"}, ""},
+	{"show", []string{"GET"}, "/{id}"},
+	{"edit", []string{"GET"}, "/{id}/edit"},
+	{"update", []string{"PUT", "PATCH"}, "/{id}"},
+	{"destroy", []string{"DELETE"}, "/{id}"},
+}
+
+// ResourceOption changes which routes Resource and APIResource register
+type ResourceOption func(*resourceOptions)
+
+type resourceOptions struct {
+	only   map[string]bool
+	except map[string]bool
+	name   string
+	param  string
+}
+
+// Only registers just the given actions (index, create, store, show, edit,
+// update, destroy)
+func Only(actions ...string) ResourceOption {
+	return func(o *resourceOptions) {
+		o.only = actionSet(actions)
+	}
+}
+
+// Except registers every action but the given ones
+func Except(actions ...string) ResourceOption {
+	return func(o *resourceOptions) {
+		o.except = actionSet(actions)
+	}
+}
+
+// Names sets the route name prefix; the default is the resource path with
+// "/" replaced by "." (/admin/users gives admin.users.index)
+func Names(name string) ResourceOption {
+	return func(o *resourceOptions) {
+		o.name = name
+	}
+}
+
+// Parameter renames the {id} param, e.g. for nested resources:
+// /users/{user}/posts with Parameter("post")
+func Parameter(name string) ResourceOption {
+	return func(o *resourceOptions) {
+		o.param = name
+	}
+}
+
+// actionSet panics on an unknown action, like Where does on an unknown param
+func actionSet(actions []string) map[string]bool {
+	set := make(map[string]bool, len(actions))
+	for _, action := range actions {
+		known := false
+		for _, a := range resourceActions {
+			known = known || a.name == action
+		}
+		if !known {
+			panic(fmt.Errorf("routes: unknown resource action %q", action))
+		}
+		set[action] = true
+	}
+	return set
+}
+
+// Resource registers the seven conventional routes of controller under path,
+// named <name>.index, <name>.create and so on. Update answers PUT and PATCH.
+func (r *Router) Resource(path string, controller ResourceController, options ...ResourceOption) RouteList {
+	return registerResource(r.addRoute, path, controller, options)
+}
+
+// APIResource registers the resource routes without the create and edit pages
+func (r *Router) APIResource(path string, controller APIController, options ...ResourceOption) RouteList {
+	return registerResource(r.addRoute, path, controller, apiOptions(options))
+}
+
+// Resource registers the conventional resource routes in the group
+func (rg *RouteGroup) Resource(path string, controller ResourceController, options ...ResourceOption) RouteList {
+	return registerResource(rg.addRoute, path, controller, options)
+}
+
+// APIResource registers the API resource routes in the group
+func (rg *RouteGroup) APIResource(path string, controller APIController, options ...ResourceOption) RouteList {
+	return registerResource(rg.addRoute, path, controller, apiOptions(options))
+}
+
+func (rg *RouteGroup) addRoute(method, path string, handler http.HandlerFunc, middleware ...Middleware) *Route {
+	return rg.add(method, path, handler, middleware)
+}
+
+// apiOptions drops create and edit before the caller's options are applied
+func apiOptions(options []ResourceOption) []ResourceOption {
+	return append([]ResourceOption{func(o *resourceOptions) {
+		o.except = map[string]bool{"create": true, "edit": true}
+	}}, options...)
+}
+
+func registerResource(add func(method, path string, handler http.HandlerFunc, middleware ...Middleware) *Route,
+	path string, controller APIController, options []ResourceOption) RouteList {
+	opts := resourceOptions{param: "id"}
+	except := map[string]bool{}
+	for _, option := range options {
+		option(&opts)
+		// Except from APIResource and from the caller add up
+		for action := range opts.except {
+			except[action] = true
+		}
+	}
+	if opts.name == "" {
+		opts.name = resourceName(path)
+	}
+
+	handlers := map[string]http.HandlerFunc{
+		"index":   controller.Index,
+		"store":   controller.Store,
+		"show":    controller.Show,
+		"update":  controller.Update,
+		"destroy": controller.Destroy,
+	}
+	if forms, ok := controller.(ResourceController); ok {
+		handlers["create"] = forms.Create
+		handlers["edit"] = forms.Edit
+	}
+
+	var routes RouteList
+	for _, action := range resourceActions {
+		if (opts.only != nil && !opts.only[action.name]) || except[action.name] {
+			continue
+		}
+		handler, ok := handlers[action.name]
+		if !ok {
+			continue
+		}
+		actionPath := strings.ReplaceAll(action.path, "{id}", "{"+opts.param+"}")
+		for _, method := range action.methods {
+			route := add(method, joinPaths(path, actionPath), handler)
+			// controller.Index is an interface method value, which runtime
+			// names routes.APIController.Index; list the concrete type instead
+			route.handlerName = strings.TrimPrefix(reflect.TypeOf(controller).String(), "*") + "." + actionMethod(action.name)
+			routes = append(routes, route.Name(opts.name+"."+action.name))
+		}
+	}
+	return routes
+}
+
+// resourceName turns /users/{user}/posts into users.posts
+func resourceName(path string) string {
+	var parts []string
+	for _, part := range splitPath(path) {
+		if part != "" && !strings.HasPrefix(part, "{") {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// actionMethod is the controller method for an action: index is Index
+func actionMethod(action string) string {
+	return strings.ToUpper(action[:1]) + action[1:]
+}
@@ -0,0 +1,143 @@
+package routes
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// Route represents a single route
+type Route struct {
+	Method     string
+	Path       string
+	Handler    http.HandlerFunc
+	Middleware []Middleware
+
+	router  *Router
+	name    string
+	wheres  map[string]string // param constraints added with Where
+	pattern *pattern
+	handler http.Handler // Handler wrapped in Middleware, composed once
+	params  []string // param names in the order the tree collects values
+
+	handlerName     string   // for route listings when Handler is a method value
+	middlewareNames []string // for route listings, see middlewareName
+
+	// OpenAPI metadata, see openapi.go
+	summary  string
+	request  reflect.Type
+	response reflect.Type
+}
+
+// Name names the route, for URL generation and route listings
+func (route *Route) Name(name string) *Route {
+	route.name = name
+	return route
+}
+
+// RouteName returns the name given with Name, empty if none
+func (route *Route) RouteName() string {
+	return route.name
+}
+
+// Summary describes the route in the OpenAPI document
+func (route *Route) Summary(summary string) *Route {
+	route.summary = summary
+	return route
+}
+
+// Request documents the JSON request body, e.g. Request(models.LoginRequest{})
+func (route *Route) Request(body interface{}) *Route {
+	route.request = reflect.TypeOf(body)
+	return route
+}
+
+// Response documents the JSON response body, e.g. Response(models.Response{})
+func (route *Route) Response(body interface{}) *Route {
+	route.response = reflect.TypeOf(body)
+	return route
+}
+
+// Where constrains a path param with a type (int, alpha, alnum, slug, uuid)
+// or a regular expression, like writing {param:constraint} in the path.
+// It panics if the route has no such param or the expression is invalid.
+func (route *Route) Where(param, constraint string) *Route {
+	if route.wheres == nil {
+		route.wheres = map[string]string{}
+	}
+	route.wheres[param] = constraint
+	route.compile()
+	if route.router != nil {
+		route.router.invalidate()
+	}
+	return route
+}
+
+// compile parses the path with the Where constraints applied
+func (route *Route) compile() {
+	p, err := parsePattern(route.Path)
+	if err != nil {
+		panic(err)
+	}
+
+	for param, constraint := range route.wheres {
+		found := false
+		for i := range p.segments {
+			seg := &p.segments[i]
+			if seg.kind != paramSegment || seg.value != param {
+				continue
+			}
+			match, err := compileConstraint(constraint)
+			if err != nil {
+				panic(fmt.Errorf("route %q: param %q: %w", route.Path, param, err))
+			}
+			seg.match = match
+			found = true
+		}
+		if !found {
+			panic(fmt.Errorf("route %q: Where(%q): no such param", route.Path, param))
+		}
+	}
+
+	route.pattern = p
+	route.params = p.paramNames()
+}
+
+// RouteList is the set of routes registered by Any or Match; Name and Where
+// apply to each of them
+type RouteList []*Route
+
+// Name names every route in the list
+func (routes RouteList) Name(name string) RouteList {
+	for _, route := range routes {
+		route.Name(name)
+	}
+	return routes
+}
+
+// Response documents the response body of every route in the list
+func (routes RouteList) Response(body interface{}) RouteList {
+	for _, route := range routes {
+		route.Response(body)
+	}
+	return routes
+}
+
+// Where constrains a path param on every route in the list that has it
+// (a resource's index and store routes have no {id}); it panics if none does
+func (routes RouteList) Where(param, constraint string) RouteList {
+	found := false
+	for _, route := range routes {
+		for _, name := range route.params {
+			if name == param {
+				route.Where(param, constraint)
+				found = true
+				break
+			}
+		}
+	}
+	if !found && len(routes) > 0 {
+		panic(fmt.Errorf("routes: Where(%q): no such param", param))
+	}
+	return routes
+}
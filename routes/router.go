@@ -2,209 +2,254 @@ package routes
 
 import (
 	"net/http"
-)
-
-// Handler is the type for route handlers
-type Handler func(http.ResponseWriter, *http.Request)
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 
-// Middleware is the type for middleware functions - accepts Handler type
-type Middleware func(Handler) Handler
+	"go-tunnel/utils"
+)
 
-// RouteGroup represents a group of routes with shared prefix and middleware
-type RouteGroup struct {
-	prefix     string
-	middleware []Middleware
-	routes     []Route
-}
+// Middleware is standard net/http middleware, so any
+// func(http.Handler) http.Handler (middleware.CheckAuth, third-party
+// packages) can be passed to a route or group as is
+type Middleware func(http.Handler) http.Handler
 
-// Route represents a single route
-type Route struct {
-	Method     string
-	Path       string
-	Handler    Handler
-	Middleware []Middleware
-}
+// anyMethods are the methods registered by Any
+var anyMethods = []string{"GET", "POST", "PUT", "DELETE", "PATCH"}
 
 // Router is the main router structure (like Laravel Router)
 type Router struct {
-	routes  []Route
-	groups  []RouteGroup
-	baseMux *http.ServeMux
+	routes []*Route
+
+	// trees holds one route trie (see node) per HTTP method. It is built on the first
+	// request after a change, since Where can still alter registered routes.
+	mu    sync.Mutex
+	trees atomic.Pointer[map[string]*node]
+
+	// OptionsHandler answers OPTIONS requests for paths without an explicit
+	// OPTIONS route (CORS preflight). The Allow header is already set when it
+	// runs; nil answers 204 No Content.
+	OptionsHandler http.Handler
 }
 
 // NewRouter creates a new router instance
 func NewRouter() *Router {
 	return &Router{
-		routes:  []Route{},
-		groups:  []RouteGroup{},
-		baseMux: http.NewServeMux(),
+		routes: []*Route{},
 	}
 }
 
 // GET registers a GET route
-func (r *Router) GET(path string, handler Handler, middleware ...Middleware) *Router {
-	r.addRoute("GET", path, handler, middleware...)
-	return r
+func (r *Router) GET(path string, handler http.HandlerFunc, middleware ...Middleware) *Route {
+	return r.addRoute("GET", path, handler, middleware...)
 }
 
 // POST registers a POST route
-func (r *Router) POST(path string, handler Handler, middleware ...Middleware) *Router {
-	r.addRoute("POST", path, handler, middleware...)
-	return r
+func (r *Router) POST(path string, handler http.HandlerFunc, middleware ...Middleware) *Route {
+	return r.addRoute("POST", path, handler, middleware...)
 }
 
 // PUT registers a PUT route
-func (r *Router) PUT(path string, handler Handler, middleware ...Middleware) *Router {
-	r.addRoute("PUT", path, handler, middleware...)
-	return r
+func (r *Router) PUT(path string, handler http.HandlerFunc, middleware ...Middleware) *Route {
+	return r.addRoute("PUT", path, handler, middleware...)
 }
 
 // DELETE registers a DELETE route
-func (r *Router) DELETE(path string, handler Handler, middleware ...Middleware) *Router {
-	r.addRoute("DELETE", path, handler, middleware...)
-	return r
+func (r *Router) DELETE(path string, handler http.HandlerFunc, middleware ...Middleware) *Route {
+	return r.addRoute("DELETE", path, handler, middleware...)
 }
 
 // PATCH registers a PATCH route
-func (r *Router) PATCH(path string, handler Handler, middleware ...Middleware) *Router {
-	r.addRoute("PATCH", path, handler, middleware...)
-	return r
+func (r *Router) PATCH(path string, handler http.HandlerFunc, middleware ...Middleware) *Route {
+	return r.addRoute("PATCH", path, handler, middleware...)
 }
 
 // Any registers a route for any HTTP method
-func (r *Router) Any(path string, handler Handler, middleware ...Middleware) *Router {
-	for _, method := range []string{"GET", "POST", "PUT", "DELETE", "PATCH"} {
-		r.addRoute(method, path, handler, middleware...)
+func (r *Router) Any(path string, handler http.HandlerFunc, middleware ...Middleware) RouteList {
+	return r.Match(anyMethods, path, handler, middleware...)
+}
+
+// Match registers a route for the given HTTP methods
+func (r *Router) Match(methods []string, path string, handler http.HandlerFunc, middleware ...Middleware) RouteList {
+	routes := make(RouteList, 0, len(methods))
+	for _, method := range methods {
+		routes = append(routes, r.addRoute(strings.ToUpper(method), path, handler, middleware...))
 	}
-	return r
+	return routes
 }
 
 // Group creates a route group with shared prefix and middleware
-func (r *Router) Group(prefix string, groupFunc func(group *RouteGroup), middleware ...Middleware) *Router {
+func (r *Router) Group(prefix string, groupFunc func(group *RouteGroup), middleware ...Middleware) *RouteGroup {
 	group := &RouteGroup{
-		prefix:     prefix,
-		middleware: middleware,
-		routes:     []Route{},
+		router:     r,
+		prefix:     joinPaths("", prefix),
+		middleware: append([]Middleware(nil), middleware...),
 	}
 	groupFunc(group)
-	
-	// Register all routes in the group
-	for _, route := range group.routes {
-		fullPath := group.prefix + route.Path
-		// Combine group middleware with route middleware
-		allMiddleware := append(group.middleware, route.Middleware...)
-		r.addRoute(route.Method, fullPath, route.Handler, allMiddleware...)
-	}
-	
-	return r
-}
-
-// Group methods for RouteGroup (to allow nested route definitions)
-func (rg *RouteGroup) GET(path string, handler Handler, middleware ...Middleware) *RouteGroup {
-	rg.routes = append(rg.routes, Route{
-		Method:     "GET",
-		Path:       path,
-		Handler:    handler,
-		Middleware: middleware,
-	})
-	return rg
+	return group
 }
 
-func (rg *RouteGroup) POST(path string, handler Handler, middleware ...Middleware) *RouteGroup {
-	rg.routes = append(rg.routes, Route{
-		Method:     "POST",
+// addRoute adds a route with middleware to the router.
+// It panics on an invalid path pattern, like http.ServeMux does.
+func (r *Router) addRoute(method string, path string, handler http.HandlerFunc, middleware ...Middleware) *Route {
+	route := &Route{
+		Method:     method,
 		Path:       path,
 		Handler:    handler,
 		Middleware: middleware,
-	})
-	return rg
-}
+		router:     r,
+	}
+	route.compile()
 
-func (rg *RouteGroup) PUT(path string, handler Handler, middleware ...Middleware) *RouteGroup {
-	rg.routes = append(rg.routes, Route{
-		Method:     "PUT",
-		Path:       path,
-		Handler:    handler,
-		Middleware: middleware,
-	})
-	return rg
-}
+	// Apply middleware to handler once, not on every request
+	route.handler = handler
+	route.middlewareNames = make([]string, len(middleware))
+	for i := len(middleware) - 1; i >= 0; i-- {
+		route.handler = middleware[i](route.handler)
+		route.middlewareNames[i] = middlewareName(middleware[i], route.handler)
+	}
 
-func (rg *RouteGroup) DELETE(path string, handler Handler, middleware ...Middleware) *RouteGroup {
-	rg.routes = append(rg.routes, Route{
-		Method:     "DELETE",
-		Path:       path,
-		Handler:    handler,
-		Middleware: middleware,
-	})
-	return rg
+	r.mu.Lock()
+	r.routes = append(r.routes, route)
+	r.mu.Unlock()
+	r.invalidate()
+	return route
 }
 
-func (rg *RouteGroup) PATCH(path string, handler Handler, middleware ...Middleware) *RouteGroup {
-	rg.routes = append(rg.routes, Route{
-		Method:     "PATCH",
-		Path:       path,
-		Handler:    handler,
-		Middleware: middleware,
-	})
-	return rg
+// invalidate drops the route trees so the next request rebuilds them
+func (r *Router) invalidate() {
+	r.trees.Store(nil)
 }
 
-// addRoute adds a route with middleware to the router
-func (r *Router) addRoute(method string, path string, handler Handler, middleware ...Middleware) {
-	// Apply middleware to handler
-	finalHandler := handler
-	for i := len(middleware) - 1; i >= 0; i-- {
-		finalHandler = middleware[i](finalHandler)
+// methodTrees returns the route trees, building them if routes changed
+func (r *Router) methodTrees() map[string]*node {
+	if trees := r.trees.Load(); trees != nil {
+		return *trees
 	}
 
-	// Store route info
-	r.routes = append(r.routes, Route{
-		Method:     method,
-		Path:       path,
-		Handler:    handler,
-		Middleware: middleware,
-	})
-
-	// Register the path if not already registered
-	alreadyRegistered := false
-	for _, route := range r.routes[:len(r.routes)-1] {
-		if route.Path == path {
-			alreadyRegistered = true
-			break
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if trees := r.trees.Load(); trees != nil {
+		return *trees
+	}
+	trees := map[string]*node{}
+	for _, route := range r.routes {
+		tree, ok := trees[route.Method]
+		if !ok {
+			tree = &node{}
+			trees[route.Method] = tree
 		}
+		// The same method and path registered twice: the first route wins
+		tree.insert(route)
 	}
+	r.trees.Store(&trees)
+	return trees
+}
 
-	if !alreadyRegistered {
-		// Create a dispatcher that checks method
-		r.baseMux.HandleFunc(path, r.dispatcher)
+// match finds the route for method and path, with its params
+func (r *Router) match(method, path string) (*Route, map[string]string) {
+	tree, ok := r.methodTrees()[method]
+	if !ok {
+		return nil, nil
+	}
+	route, values := tree.lookup(splitPath(path), nil)
+	if route == nil || len(values) == 0 {
+		return route, nil
 	}
+	params := make(map[string]string, len(values))
+	for i, value := range values {
+		params[route.params[i]] = value
+	}
+	return route, params
 }
 
 // dispatcher is a custom dispatcher that matches method and calls appropriate handler
 func (r *Router) dispatcher(w http.ResponseWriter, req *http.Request) {
-	// Find matching route by path and method
-	for _, route := range r.routes {
-		if route.Path == req.URL.Path && (route.Method == req.Method || route.Method == "ANY") {
-			// Apply middleware
-			handler := route.Handler
-			for i := len(route.Middleware) - 1; i >= 0; i-- {
-				handler = route.Middleware[i](handler)
+	route, params := r.match(req.Method, req.URL.Path)
+	if route == nil && req.Method == http.MethodHead {
+		// HEAD is answered by the GET handler, net/http drops the body
+		route, params = r.match(http.MethodGet, req.URL.Path)
+	}
+	if route == nil {
+		allowed := r.allowedMethods(req.URL.Path)
+		switch {
+		case len(allowed) == 0:
+			// No matching route found
+			http.NotFound(w, req)
+		case req.Method == http.MethodOptions:
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			if r.OptionsHandler != nil {
+				r.OptionsHandler.ServeHTTP(w, req)
+			} else {
+				w.WriteHeader(http.StatusNoContent)
 			}
-			handler(w, req)
-			return
+		default:
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			utils.SendStatusResponse(w, http.StatusMethodNotAllowed, false, "Method not allowed", nil)
 		}
+		return
 	}
-	// No matching route found
-	http.NotFound(w, req)
+	if params != nil {
+		req = utils.WithParams(req, params)
+	}
+	route.handler.ServeHTTP(w, req)
+}
+
+// methodOrder sorts the Allow header the way the methods are usually listed
+var methodOrder = map[string]int{
+	http.MethodGet: 0, http.MethodHead: 1, http.MethodPost: 2, http.MethodPut: 3,
+	http.MethodPatch: 4, http.MethodDelete: 5, http.MethodOptions: 6,
+}
+
+// allowedMethods lists the methods that have a route for path, with HEAD
+// (when GET exists) and OPTIONS added; empty if the path has no routes at all
+func (r *Router) allowedMethods(path string) []string {
+	parts := splitPath(path)
+	seen := map[string]bool{}
+	for method, tree := range r.methodTrees() {
+		if route, _ := tree.lookup(parts, nil); route != nil {
+			seen[method] = true
+		}
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+	if seen[http.MethodGet] {
+		seen[http.MethodHead] = true
+	}
+	seen[http.MethodOptions] = true
+
+	allowed := make([]string, 0, len(seen))
+	for method := range seen {
+		allowed = append(allowed, method)
+	}
+	sort.Slice(allowed, func(i, j int) bool {
+		oi, iKnown := methodOrder[allowed[i]]
+		oj, jKnown := methodOrder[allowed[j]]
+		if iKnown != jKnown {
+			return iKnown
+		}
+		if oi != oj {
+			return oi < oj
+		}
+		return allowed[i] < allowed[j]
+	})
+	return allowed
 }
 
 // ServeHTTP makes Router implement http.Handler interface
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	r.baseMux.ServeHTTP(w, req)
+	r.dispatcher(w, req)
 }
 
 // ListRoutes returns all registered routes (for debugging)
 func (r *Router) ListRoutes() []Route {
-	return r.routes
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	routes := make([]Route, len(r.routes))
+	for i, route := range r.routes {
+		routes[i] = *route
+	}
+	return routes
 }
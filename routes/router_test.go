@@ -0,0 +1,451 @@
+package routes
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-tunnel/utils"
+)
+
+// discard is a ResponseWriter that drops the response, so only the lookup
+// is measured
+type discard struct{ header http.Header }
+
+func (d *discard) Header() http.Header         { return d.header }
+func (d *discard) Write(p []byte) (int, error) { return len(p), nil }
+func (d *discard) WriteHeader(int)             {}
+
+func benchRouter(n int) *Router {
+	router := NewRouter()
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	noop := func(next http.Handler) http.Handler { return next }
+
+	for i := 0; i < n/4; i++ {
+		router.GET(fmt.Sprintf("/api/v1/resource%d", i), ok, noop)
+		router.GET(fmt.Sprintf("/api/v1/resource%d/{id:int}", i), ok, noop)
+		router.PUT(fmt.Sprintf("/api/v1/resource%d/{id:int}", i), ok, noop)
+		router.GET(fmt.Sprintf("/api/v1/resource%d/{id}/items/{item}/files/{path...}", i), ok, noop)
+	}
+	return router
+}
+
+// BenchmarkLookup measures routing cost by route count; with the segment
+// trie the numbers for 100 and 5000 routes should be about the same.
+//
+//	go test ./routes -run '^$' -bench Lookup -benchmem
+func BenchmarkLookup(b *testing.B) {
+	cases := []struct {
+		name, method, path string
+	}{
+		{"static", "GET", "/api/v1/resource%d"},
+		{"param", "PUT", "/api/v1/resource%d/42"},
+		{"wildcard", "GET", "/api/v1/resource%d/7/items/x/files/a/b/c.txt"},
+		{"not_found", "GET", "/api/v1/resource%d/42/missing"},
+	}
+
+	for _, n := range []int{100, 1000, 5000} {
+		router := benchRouter(n)
+		// The last registered resource is the worst case for a linear scan
+		last := n/4 - 1
+
+		for _, c := range cases {
+			b.Run(fmt.Sprintf("routes=%d/%s", n, c.name), func(b *testing.B) {
+				req := httptest.NewRequest(c.method, fmt.Sprintf(c.path, last), nil)
+				w := &discard{header: http.Header{}}
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					router.ServeHTTP(w, req)
+				}
+			})
+		}
+	}
+}
+
+// echo answers with its label and the route params, so a test sees which
+// route matched and what it captured
+func echo(label string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %v", label, utils.Params(r))
+	}
+}
+
+func serve(router *Router, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestParams(t *testing.T) {
+	router := NewRouter()
+	router.GET("/", echo("root"))
+	router.GET("/users", echo("users"))
+	router.GET("/users/me", echo("me"))
+	router.GET("/users/{id:int}", echo("user-by-id"))
+	router.GET("/users/{name}", echo("user-by-name"))
+	router.GET("/users/{id}/posts/{post:slug}", echo("post"))
+	router.GET("/tags/{tag:v[0-9]+}", echo("version"))
+	router.GET("/items/{id}", echo("item")).Where("id", "uuid")
+	router.GET("/files/{path...}", echo("files"))
+
+	cases := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/", 200, "root map[]"},
+		{"/users", 200, "users map[]"},
+		{"/users/me", 200, "me map[]"},
+		{"/users/42", 200, "user-by-id map[id:42]"},
+		{"/users/alice", 200, "user-by-name map[name:alice]"},
+		{"/users/42/posts/hello-world", 200, "post map[id:42 post:hello-world]"},
+		{"/users/42/posts/Hello_World", 404, ""},
+		{"/tags/v2", 200, "version map[tag:v2]"},
+		{"/tags/v2beta", 404, ""},
+		{"/items/123e4567-e89b-12d3-a456-426614174000", 200, "item map[id:123e4567-e89b-12d3-a456-426614174000]"},
+		{"/items/42", 404, ""},
+		{"/files", 200, "files map[path:]"},
+		{"/files/a", 200, "files map[path:a]"},
+		{"/files/a/b/c.txt", 200, "files map[path:a/b/c.txt]"},
+		// No implicit trailing-slash redirect: /users/ is another path
+		{"/users/", 404, ""},
+		{"/users/42/", 404, ""},
+		{"/missing", 404, ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			w := serve(router, "GET", c.path)
+			if w.Code != c.status {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, c.status, w.Body.String())
+			}
+			if c.body != "" && w.Body.String() != c.body {
+				t.Errorf("body = %q, want %q", w.Body.String(), c.body)
+			}
+		})
+	}
+}
+
+func TestInvalidPatterns(t *testing.T) {
+	for _, path := range []string{
+		"users",
+		"/files/{path...}/more",
+		"/users/{id}/{id}",
+		"/users/{}",
+		"/users/x{id}",
+		"/users/{id:[}",
+	} {
+		t.Run(path, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("GET(%q) did not panic", path)
+				}
+			}()
+			NewRouter().GET(path, echo("x"))
+		})
+	}
+}
+
+func TestMethods(t *testing.T) {
+	router := NewRouter()
+	router.GET("/users", echo("list"))
+	router.POST("/users", echo("create"))
+	router.GET("/users/{id:int}", echo("show"))
+	router.DELETE("/users/{id:int}", echo("delete"))
+	router.Match([]string{"OPTIONS"}, "/custom", echo("custom-options"))
+	router.PUT("/custom", echo("custom-put"))
+	router.GET("/head", echo("get"))
+	router.Match([]string{"HEAD"}, "/head", echo("head"))
+
+	cases := []struct {
+		method, path string
+		status       int
+		allow        string
+		body         string
+	}{
+		{"PUT", "/users", 405, "GET, HEAD, POST, OPTIONS", `{"success":false,"message":"Method not allowed"}` + "\n"},
+		{"PATCH", "/users/5", 405, "GET, HEAD, DELETE, OPTIONS", ""},
+		// The constraint decides whether the path exists at all
+		{"PATCH", "/users/abc", 404, "", ""},
+		{"HEAD", "/users", 200, "", ""},
+		{"HEAD", "/users/5", 200, "", ""},
+		{"HEAD", "/head", 200, "", "head map[]"},
+		{"OPTIONS", "/users", 204, "GET, HEAD, POST, OPTIONS", ""},
+		{"OPTIONS", "/users/5", 204, "GET, HEAD, DELETE, OPTIONS", ""},
+		{"OPTIONS", "/custom", 200, "", "custom-options map[]"},
+		{"OPTIONS", "/missing", 404, "", ""},
+	}
+
+	for _, c := range cases {
+		t.Run(c.method+" "+c.path, func(t *testing.T) {
+			w := serve(router, c.method, c.path)
+			if w.Code != c.status {
+				t.Fatalf("status = %d, want %d", w.Code, c.status)
+			}
+			if got := w.Header().Get("Allow"); got != c.allow {
+				t.Errorf("Allow = %q, want %q", got, c.allow)
+			}
+			if c.status == 405 && w.Header().Get("Content-Type") != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", w.Header().Get("Content-Type"))
+			}
+			if c.body != "" && w.Body.String() != c.body {
+				t.Errorf("body = %q, want %q", w.Body.String(), c.body)
+			}
+		})
+	}
+}
+
+func TestOptionsHandler(t *testing.T) {
+	router := NewRouter()
+	router.GET("/users", echo("list"))
+	router.OptionsHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Methods", w.Header().Get("Allow"))
+		w.WriteHeader(http.StatusOK)
+	})
+
+	w := serve(router, "OPTIONS", "/users")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, HEAD, OPTIONS" {
+		t.Errorf("OptionsHandler saw Allow %q, want %q", got, "GET, HEAD, OPTIONS")
+	}
+}
+
+// trace is middleware that writes its name before calling the next handler
+func trace(name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, name+" ")
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestGroupMiddlewareOrder(t *testing.T) {
+	router := NewRouter()
+	handler := func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "handler") }
+
+	router.Group("/api", func(api *RouteGroup) {
+		api.GET("/ping", handler)
+		api.Group("/v1", func(v1 *RouteGroup) {
+			v1.GET("/users", handler, trace("route"))
+			v1.Group("/admin", func(admin *RouteGroup) {
+				admin.GET("/stats", handler, trace("route"))
+			}, trace("admin"))
+		}, trace("v1"), trace("v1b"))
+		// A sibling group must not see v1's middleware
+		api.Group("/v2", func(v2 *RouteGroup) {
+			v2.GET("/users", handler)
+		}, trace("v2"))
+	}, trace("api"))
+	router.GET("/plain", handler, trace("first"), trace("second"))
+
+	cases := []struct {
+		path, body string
+	}{
+		{"/api/ping", "api handler"},
+		{"/api/v1/users", "api v1 v1b route handler"},
+		{"/api/v1/admin/stats", "api v1 v1b admin route handler"},
+		{"/api/v2/users", "api v2 handler"},
+		{"/plain", "first second handler"},
+	}
+	for _, c := range cases {
+		t.Run(c.path, func(t *testing.T) {
+			if got := serve(router, "GET", c.path).Body.String(); got != c.body {
+				t.Errorf("body = %q, want %q", got, c.body)
+			}
+		})
+	}
+}
+
+func TestURL(t *testing.T) {
+	router := NewRouter()
+	router.GET("/users", echo("x")).Name("users.index")
+	router.GET("/users/{id:int}", echo("x")).Name("users.show")
+	router.GET("/users/{user}/posts/{post:slug}", echo("x")).Name("posts.show")
+	router.GET("/files/{path...}", echo("x")).Name("files")
+
+	cases := []struct {
+		name   string
+		params []interface{}
+		want   string
+		err    bool
+	}{
+		{"users.index", nil, "/users", false},
+		{"users.index", []interface{}{map[string]string{"page": "2"}}, "/users?page=2", false},
+		{"users.show", []interface{}{5}, "/users/5", false},
+		{"users.show", []interface{}{map[string]interface{}{"id": 5, "tab": "posts"}}, "/users/5?tab=posts", false},
+		{"posts.show", []interface{}{"a b", "hello-world"}, "/users/a%20b/posts/hello-world", false},
+		{"posts.show", []interface{}{map[string]string{"post": "hi"}, "alice"}, "/users/alice/posts/hi", false},
+		{"files", []interface{}{"a/b c.txt"}, "/files/a/b%20c.txt", false},
+
+		{"missing", nil, "", true},
+		{"users.show", nil, "", true},                  // missing param
+		{"users.show", []interface{}{"abc"}, "", true}, // fails {id:int}
+		{"users.show", []interface{}{""}, "", true},    // empty value
+		{"users.show", []interface{}{5, 6}, "", true},  // too many params
+		{"posts.show", []interface{}{"alice", "Not A Slug"}, "", true},
+	}
+
+	for _, c := range cases {
+		t.Run(fmt.Sprint(c.name, c.params), func(t *testing.T) {
+			got, err := router.URL(c.name, c.params...)
+			if c.err {
+				if err == nil {
+					t.Errorf("URL = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != c.want {
+				t.Errorf("URL = %q, %v; want %q", got, err, c.want)
+			}
+		})
+	}
+}
+
+type userController struct{}
+
+func (userController) Index(w http.ResponseWriter, r *http.Request)   {}
+func (userController) Store(w http.ResponseWriter, r *http.Request)   {}
+func (userController) Show(w http.ResponseWriter, r *http.Request)    {}
+func (userController) Update(w http.ResponseWriter, r *http.Request)  {}
+func (userController) Destroy(w http.ResponseWriter, r *http.Request) {}
+func (userController) Create(w http.ResponseWriter, r *http.Request)  {}
+func (userController) Edit(w http.ResponseWriter, r *http.Request)    {}
+
+func TestResourceOptions(t *testing.T) {
+	cases := []struct {
+		name     string
+		register func(r *Router) RouteList
+		want     []string
+	}{
+		{"resource", func(r *Router) RouteList {
+			return r.Resource("/users", userController{})
+		}, []string{
+			"GET /users users.index", "GET /users/create users.create", "POST /users users.store",
+			"GET /users/{id} users.show", "GET /users/{id}/edit users.edit",
+			"PUT /users/{id} users.update", "PATCH /users/{id} users.update", "DELETE /users/{id} users.destroy",
+		}},
+		{"api resource", func(r *Router) RouteList {
+			return r.APIResource("/users", userController{})
+		}, []string{
+			"GET /users users.index", "POST /users users.store", "GET /users/{id} users.show",
+			"PUT /users/{id} users.update", "PATCH /users/{id} users.update", "DELETE /users/{id} users.destroy",
+		}},
+		{"only", func(r *Router) RouteList {
+			return r.Resource("/users", userController{}, Only("index", "show"))
+		}, []string{"GET /users users.index", "GET /users/{id} users.show"}},
+		{"except", func(r *Router) RouteList {
+			return r.Resource("/users", userController{}, Except("create", "edit", "destroy"))
+		}, []string{
+			"GET /users users.index", "POST /users users.store", "GET /users/{id} users.show",
+			"PUT /users/{id} users.update", "PATCH /users/{id} users.update",
+		}},
+		// Only can't bring back what APIResource leaves out
+		{"api only create", func(r *Router) RouteList {
+			return r.APIResource("/users", userController{}, Only("index", "create"))
+		}, []string{"GET /users users.index"}},
+		{"api except adds up", func(r *Router) RouteList {
+			return r.APIResource("/users", userController{}, Except("destroy"))
+		}, []string{
+			"GET /users users.index", "POST /users users.store", "GET /users/{id} users.show",
+			"PUT /users/{id} users.update", "PATCH /users/{id} users.update",
+		}},
+		{"nested in a group", func(r *Router) RouteList {
+			var routes RouteList
+			r.Group("/api", func(api *RouteGroup) {
+				routes = api.APIResource("/users/{user}/posts", userController{},
+					Only("show"), Parameter("post"), Names("posts"))
+			})
+			return routes
+		}, []string{"GET /api/users/{user}/posts/{post} posts.show"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			routes := c.register(NewRouter())
+			var got []string
+			for _, route := range routes {
+				got = append(got, route.Method+" "+route.Path+" "+route.RouteName())
+			}
+			if fmt.Sprint(got) != fmt.Sprint(c.want) {
+				t.Errorf("routes =\n%v\nwant\n%v", got, c.want)
+			}
+		})
+	}
+}
+
+func TestResourceUnknownAction(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Only with an unknown action did not panic")
+		}
+	}()
+	NewRouter().Resource("/users", userController{}, Only("list"))
+}
+
+func TestConflicts(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	cases := []struct {
+		name     string
+		register func(r *Router)
+		want     []string // "kept <- shadowed"
+	}{
+		{"none", func(r *Router) {
+			r.GET("/users", ok)
+			r.POST("/users", ok)
+			r.GET("/users/{id:int}", ok)
+			r.GET("/users/{name}", ok)
+			r.GET("/users/me", ok)
+		}, nil},
+		{"same path", func(r *Router) {
+			r.GET("/users", ok)
+			r.GET("/users", ok)
+		}, []string{"GET /users <- GET /users"}},
+		{"param names differ", func(r *Router) {
+			r.GET("/users/{id}", ok)
+			r.GET("/users/{user}", ok)
+		}, []string{"GET /users/{id} <- GET /users/{user}"}},
+		{"inline and Where constraint", func(r *Router) {
+			r.GET("/users/{id:int}", ok)
+			r.GET("/users/{user}", ok).Where("user", "int")
+		}, []string{"GET /users/{id:int} <- GET /users/{user}"}},
+		{"wildcards", func(r *Router) {
+			r.GET("/files/{path...}", ok)
+			r.GET("/files/{rest...}", ok)
+		}, []string{"GET /files/{path...} <- GET /files/{rest...}"}},
+		{"group and resource", func(r *Router) {
+			r.Group("/api", func(api *RouteGroup) {
+				api.GET("/users/{id}", ok)
+				api.APIResource("/users", userController{}, Only("show", "destroy"))
+			})
+		}, []string{"GET /api/users/{id} <- GET /api/users/{id}"}},
+		{"any", func(r *Router) {
+			r.DELETE("/hook", ok)
+			r.Any("/hook", ok)
+		}, []string{"DELETE /hook <- DELETE /hook"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			router := NewRouter()
+			c.register(router)
+			var got []string
+			for _, conflict := range router.Conflicts() {
+				got = append(got, fmt.Sprintf("%s %s <- %s %s", conflict.Route.Method, conflict.Route.Path,
+					conflict.Shadowed.Method, conflict.Shadowed.Path))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(c.want) {
+				t.Errorf("conflicts = %v, want %v", got, c.want)
+			}
+
+			err := ListCommand(router, []string{"-fail-on-conflict"}, io.Discard, io.Discard)
+			if (err != nil) != (len(c.want) > 0) {
+				t.Errorf("ListCommand -fail-on-conflict error = %v with %d conflicts", err, len(c.want))
+			}
+		})
+	}
+}
@@ -5,61 +5,85 @@ import (
 
 	"go-tunnel/handlers"
 	"go-tunnel/middleware"
+	"go-tunnel/models"
 )
 
-// ConvertMiddleware converts middleware.Handler to routes.Middleware
-func ConvertMiddleware(m func(middleware.Handler) middleware.Handler) Middleware {
-	return func(h Handler) Handler {
-		return func(w http.ResponseWriter, r *http.Request) {
-			// Convert h to middleware.Handler
-			mh := middleware.Handler(h)
-			// Apply middleware
-			result := m(mh)
-			// Call result with ResponseWriter and Request
-			result(w, r)
-		}
-	}
+func noContent(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
 }
 
 // SetupRoutes configures all application routes with middleware (Laravel-style)
 func SetupRoutes() *Router {
 	router := NewRouter()
 
+	// Automatic OPTIONS answers (CORS preflight) for every registered path
+	router.OptionsHandler = middleware.CORS(http.HandlerFunc(noContent))
+
 	// Public routes (without middleware)
-	router.POST("/login", handlers.LoginHandler)
-	router.GET("/health", handlers.HealthCheck)
+	router.POST("/login", handlers.LoginHandler).Name("login").Request(models.LoginRequest{}).Response(models.Response{})
+	router.GET("/health", handlers.HealthCheck).Name("health").Summary("Health check").Response(models.Response{})
 
 	// Admin panel routes
-	router.POST("/admin/register", handlers.AdminRegister)
-	router.POST("/admin/login", handlers.AdminLogin)
-	router.POST("/admin/generate-token", handlers.AdminGenerateToken)
+	router.POST("/admin/register", handlers.AdminRegister).Name("admin.register").Request(models.LoginRequest{}).Response(models.Response{})
+	router.POST("/admin/login", handlers.AdminLogin).Name("admin.login").Request(models.LoginRequest{}).Response(models.Response{})
 	// Serve admin panel static files using default http.FileServer in main.go
 
 	// API routes with auth middleware
 	router.Group("/api", func(group *RouteGroup) {
-		// User routes with auth middleware
-		group.GET("/users", handlers.GetUsers, ConvertMiddleware(middleware.CheckAuth))
-		group.POST("/users", handlers.CreateUser, ConvertMiddleware(middleware.CheckAuth))
-		group.GET("/users/{id}", handlers.GetUser, ConvertMiddleware(middleware.CheckAuth))
-		group.PUT("/users/{id}", handlers.UpdateUser, ConvertMiddleware(middleware.CheckAuth))
-		group.DELETE("/users/{id}", handlers.DeleteUser, ConvertMiddleware(middleware.CheckAuth))
-	}, ConvertMiddleware(middleware.CheckAuth), ConvertMiddleware(middleware.CORS))
+		// User resource: users.index, users.store, users.show, users.update, users.destroy
+		group.APIResource("/users", handlers.UserController{}).Where("id", "int").Response(models.Response{})
+
+		// Reserved tunnel names (alice.<tunnel-domain>)
+		group.GET("/tunnels", handlers.ListReservedDomains).Name("tunnels.index").Response(models.Response{})
+		group.POST("/tunnels", handlers.ReserveDomain).Name("tunnels.store").Request(models.ReserveDomainRequest{}).Response(models.Response{})
+		group.DELETE("/tunnels", handlers.ReleaseDomain).Name("tunnels.destroy").Request(models.ReserveDomainRequest{}).Response(models.Response{})
+
+		// Custom domains (dev.customer.com -> reserved tunnel)
+		group.GET("/domains", handlers.ListCustomDomains).Name("domains.index").Response(models.Response{})
+		group.POST("/domains", handlers.AddCustomDomain).Name("domains.store").Request(models.CustomDomainRequest{}).Response(models.Response{})
+		group.POST("/domains/verify", handlers.VerifyCustomDomain).Name("domains.verify").Request(models.CustomDomainRequest{}).Response(models.Response{})
+		group.DELETE("/domains", handlers.RemoveCustomDomain).Name("domains.destroy").Request(models.CustomDomainRequest{}).Response(models.Response{})
+	}, middleware.CheckAuth, middleware.CORS)
 
 	// Admin routes with admin middleware
 	router.Group("/admin", func(group *RouteGroup) {
-		group.GET("/dashboard", handlers.AdminDashboard, ConvertMiddleware(middleware.AdminOnly))
-		group.GET("/users", handlers.GetAllUsers, ConvertMiddleware(middleware.AdminOnly))
-		group.DELETE("/users/{id}", handlers.DeleteUserAdmin, ConvertMiddleware(middleware.AdminOnly))
-	}, ConvertMiddleware(middleware.AdminOnly))
+		group.GET("/dashboard", handlers.AdminDashboard, middleware.AdminOnly).Name("admin.dashboard").Response(models.Response{})
+		group.GET("/events", handlers.AdminEvents, middleware.AdminOnly).Name("admin.events")
+		group.GET("/users", handlers.GetAllUsers, middleware.AdminOnly).Name("admin.users.index").Response(models.Response{})
+		group.DELETE("/users/{id:int}", handlers.DeleteUserAdmin, middleware.AdminOnly).Name("admin.users.destroy").Response(models.Response{})
+	}, middleware.AdminOnly)
 
 	// Auth routes
 	router.Group("/auth", func(group *RouteGroup) {
-		group.POST("/register", handlers.Register)
-		group.POST("/login", handlers.Login)
-		group.POST("/logout", handlers.Logout, ConvertMiddleware(middleware.CheckAuth))
-		group.POST("/refresh", handlers.RefreshToken, ConvertMiddleware(middleware.CheckAuth))
-	}, ConvertMiddleware(middleware.CORS))
+		group.POST("/register", handlers.Register).Name("auth.register").Request(models.RegisterRequest{}).Response(models.Response{})
+		group.POST("/login", handlers.Login).Name("auth.login").Request(models.LoginRequest{}).Response(models.Response{})
+		group.POST("/logout", handlers.Logout, middleware.CheckAuth).Name("auth.logout").Summary("Log out (?all=true: every session)").Response(models.Response{})
+		// No CheckAuth: the access token has usually expired by the time a client refreshes
+		group.POST("/refresh", handlers.RefreshToken).Name("auth.refresh").Request(models.RefreshRequest{}).Response(models.Response{})
+	}, middleware.CORS)
+
+	// Public keys for verifying JWTs, e.g. on tunnel edge nodes (JWT_JWKS_URL)
+	router.GET("/.well-known/jwks.json", handlers.JWKS).Name("jwks").Summary("JWT verification keys (JWKS)")
+
+	// API docs generated from the routes above
+	router.GET("/openapi.json", router.OpenAPIHandler(apiInfo)).Name("openapi")
+	router.GET("/docs", DocsHandler("/openapi.json")).Name("docs")
 
 	return router
 }
 
+// apiInfo describes the API in /openapi.json; the security schemes follow
+// what CheckAuth and AdminOnly read from the request
+var apiInfo = OpenAPIInfo{
+	Title:   "go-tunnel API",
+	Version: "1.0.0",
+	SecuritySchemes: map[string]SecurityScheme{
+		"bearerAuth": {Type: "http", Scheme: "bearer", Description: "Opaque access token or a JWT from the login response"},
+		"adminToken": {Type: "apiKey", In: "header", Name: "X-Admin-Token", Description: "The ADMIN_TOKEN secret"},
+	},
+	MiddlewareSecurity: map[string]string{
+		"middleware.CheckAuth": "bearerAuth",
+		"middleware.AdminOnly": "adminToken",
+	},
+}
+
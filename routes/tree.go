@@ -0,0 +1,151 @@
+package routes
+
+// node is one path segment in a method's route trie. The trie is keyed by
+// whole segments: each node keeps a map of its static children. This is a
+// deliberate narrowing of the radix tree first asked for: params and
+// wildcards always span whole segments, so byte-level path compression would
+// only merge static chains, and the map lookup per segment already makes the
+// cost independent of the route count (see BenchmarkLookup).
+//
+// Lookup walks the trie segment by segment, trying static children first,
+// then params (constrained before unconstrained), then a wildcard, and
+// backtracks on a dead end, so its cost grows with the path depth rather
+// than with the number of registered routes.
+type node struct {
+	static   map[string]*node
+	params   []*node // children for {name} segments, most specific first
+	wildcard *node   // child for a trailing {name...}
+	seg      segment // the segment this node matched (params and wildcard)
+	route    *Route  // route ending at this node
+}
+
+// insert adds route under its pattern; it returns the route already
+// registered for an equivalent pattern, if any (the first one is kept)
+func (n *node) insert(route *Route) *Route {
+	for _, seg := range route.pattern.segments {
+		n = n.child(seg)
+	}
+	if n.route != nil {
+		return n.route
+	}
+	n.route = route
+	return nil
+}
+
+// child returns the node for seg, creating it if needed
+func (n *node) child(seg segment) *node {
+	switch seg.kind {
+	case staticSegment:
+		if n.static == nil {
+			n.static = map[string]*node{}
+		}
+		next, ok := n.static[seg.value]
+		if !ok {
+			next = &node{}
+			n.static[seg.value] = next
+		}
+		return next
+
+	case wildcardSegment:
+		if n.wildcard == nil {
+			n.wildcard = &node{seg: seg}
+		}
+		return n.wildcard
+	}
+
+	// Same param name and constraint share a node: /users/{id}/posts and
+	// /users/{id}/comments
+	for _, next := range n.params {
+		if next.seg.value == seg.value && sameConstraint(next.seg, seg) {
+			return next
+		}
+	}
+	next := &node{seg: seg}
+	// Constrained params are tried before unconstrained ones
+	i := len(n.params)
+	if seg.match != nil {
+		for i = 0; i < len(n.params) && n.params[i].seg.match != nil; i++ {
+		}
+	}
+	n.params = append(n.params, nil)
+	copy(n.params[i+1:], n.params[i:])
+	n.params[i] = next
+	return next
+}
+
+func sameConstraint(a, b segment) bool {
+	if a.match == nil || b.match == nil {
+		return a.match == b.match
+	}
+	return a.match.String() == b.match.String()
+}
+
+// lookup finds the route for the split path; values collects the param
+// values along the way in tree order
+func (n *node) lookup(parts []string, values []string) (*Route, []string) {
+	if len(parts) == 0 {
+		if n.route != nil {
+			return n.route, values
+		}
+		// /files/{path...} also matches /files
+		if n.wildcard != nil && n.wildcard.route != nil {
+			return n.wildcard.route, append(values, "")
+		}
+		return nil, values
+	}
+
+	part := parts[0]
+	if next, ok := n.static[part]; ok {
+		if route, found := next.lookup(parts[1:], values); route != nil {
+			return route, found
+		}
+	}
+
+	if part != "" {
+		for _, next := range n.params {
+			if next.seg.match != nil && !next.seg.match.MatchString(part) {
+				continue
+			}
+			if route, found := next.lookup(parts[1:], append(values, part)); route != nil {
+				return route, found
+			}
+		}
+	}
+
+	if n.wildcard != nil && n.wildcard.route != nil {
+		return n.wildcard.route, append(values, joinPath(parts))
+	}
+	return nil, values
+}
+
+// joinPath is strings.Join(parts, "/") without the extra allocation for the
+// common single-segment case
+func joinPath(parts []string) string {
+	if len(parts) == 1 {
+		return parts[0]
+	}
+	size := len(parts) - 1
+	for _, part := range parts {
+		size += len(part)
+	}
+	b := make([]byte, 0, size)
+	for i, part := range parts {
+		if i > 0 {
+			b = append(b, '/')
+		}
+		b = append(b, part...)
+	}
+	return string(b)
+}
+
+// paramNames lists the names of a pattern's params in tree order, to pair
+// with the values collected by lookup
+func (p *pattern) paramNames() []string {
+	var names []string
+	for _, seg := range p.segments {
+		if seg.kind != staticSegment {
+			names = append(names, seg.value)
+		}
+	}
+	return names
+}
@@ -0,0 +1,109 @@
+package routes
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// URL builds the path of the route named name, like Laravel's route():
+//
+//	router.URL("users.show", 5)                                  // /api/users/5
+//	router.URL("users.show", map[string]interface{}{"id": 5})    // /api/users/5
+//	router.URL("users.index", map[string]string{"page": "2"})    // /api/users?page=2
+//
+// Scalar params fill the path params in order; maps (or url.Values) fill
+// them by name and whatever is left becomes the query string. Missing or
+// invalid path params and unknown names are errors.
+func (r *Router) URL(name string, params ...interface{}) (string, error) {
+	route := r.named(name)
+	if route == nil {
+		return "", fmt.Errorf("route %q not defined", name)
+	}
+
+	named := url.Values{}
+	var positional []string
+	for _, param := range params {
+		switch v := param.(type) {
+		case map[string]interface{}:
+			for key, value := range v {
+				named.Add(key, fmt.Sprint(value))
+			}
+		case map[string]string:
+			for key, value := range v {
+				named.Add(key, value)
+			}
+		case url.Values:
+			for key, values := range v {
+				named[key] = append(named[key], values...)
+			}
+		default:
+			positional = append(positional, fmt.Sprint(v))
+		}
+	}
+
+	var path strings.Builder
+	for _, seg := range route.pattern.segments {
+		path.WriteByte('/')
+		if seg.kind == staticSegment {
+			path.WriteString(seg.value)
+			continue
+		}
+
+		value, ok := "", false
+		if values, found := named[seg.value]; found && len(values) > 0 {
+			value, ok = values[0], true
+			delete(named, seg.value)
+		} else if len(positional) > 0 {
+			value, ok = positional[0], true
+			positional = positional[1:]
+		}
+		if !ok {
+			return "", fmt.Errorf("route %q: missing param %q", name, seg.value)
+		}
+
+		if seg.kind == wildcardSegment {
+			// {path...} keeps its slashes
+			parts := strings.Split(strings.TrimPrefix(value, "/"), "/")
+			for i, part := range parts {
+				parts[i] = url.PathEscape(part)
+			}
+			path.WriteString(strings.Join(parts, "/"))
+			continue
+		}
+		if value == "" || (seg.match != nil && !seg.match.MatchString(value)) {
+			return "", fmt.Errorf("route %q: invalid value %q for param %q", name, value, seg.value)
+		}
+		path.WriteString(url.PathEscape(value))
+	}
+	if len(positional) > 0 {
+		return "", fmt.Errorf("route %q: too many params: %v", name, positional)
+	}
+
+	result := path.String()
+	if len(named) > 0 {
+		result += "?" + named.Encode()
+	}
+	return result, nil
+}
+
+// MustURL is URL for routes known to exist; it panics on error
+func (r *Router) MustURL(name string, params ...interface{}) string {
+	u, err := r.URL(name, params...)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// named returns the first route registered with name
+func (r *Router) named(name string) *Route {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, route := range r.routes {
+		if route.name == name {
+			return route
+		}
+	}
+	return nil
+}
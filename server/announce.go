@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net"
+	"strconv"
+
+	"go-tunnel/tunnel"
+)
+
+// build.go -ldflags orqali beriladi
+var (
+	version = "dev"
+	commit  = ""
+	date    = ""
+)
+
+// announcer - clientga tanishuvdan keyin yuboriladigan ro'yxatdan o'tish natijasi
+// (public URL, portlar, limitlar)
+type announcer struct {
+	scheme string // http yoki https (server proxy/TLS orqasida bo'lsa)
+	host   string // -public dagi host ("" yoki 0.0.0.0 - client ulangan IP)
+	port   int    // URL dagi port
+	domain string
+	// customDomains tunnelning tasdiqlangan custom domenlari (-db bo'lmasa nil)
+	customDomains func(name string) ([]string, error)
+	publicPort    int // server haqiqatda tinglayotgan port
+}
+
+func newAnnouncer(publicAddr, scheme string, urlPort int, domain string) *announcer {
+	host, portText, _ := net.SplitHostPort(publicAddr)
+	port, _ := strconv.Atoi(portText)
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = ""
+	}
+	a := &announcer{scheme: scheme, host: host, port: port, domain: domain, publicPort: port}
+	if urlPort > 0 {
+		a.port = urlPort
+	}
+	return a
+}
+
+// registration tunnel nomi uchun natija; conn - clientning control ulanishi
+func (a *announcer) registration(name string, conn net.Conn) *tunnel.Registration {
+	result := &tunnel.Registration{
+		Tunnel:        name,
+		URLs:          []string{},
+		Ports:         []int{a.publicPort},
+		Limits:        tunnel.Limits{MaxIdle: poolSize},
+		ServerVersion: version,
+	}
+
+	switch {
+	case a.domain != "" && name != "":
+		result.URLs = append(result.URLs, a.url(name+"."+a.domain))
+	case a.domain != "":
+		result.URLs = append(result.URLs, a.url(a.domain))
+	case name == "":
+		// Domen yo'q: anonim tunnel server IP si orqali ochiladi
+		host := a.host
+		if host == "" {
+			host, _, _ = net.SplitHostPort(conn.LocalAddr().String())
+		}
+		result.URLs = append(result.URLs, a.url(host))
+	}
+
+	if a.customDomains != nil && name != "" {
+		domains, err := a.customDomains(name)
+		if err != nil {
+			monitor.Error("Custom domenlarni o'qib bo'lmadi (%q): %v", name, err)
+		}
+		for _, domain := range domains {
+			result.URLs = append(result.URLs, a.url(domain))
+		}
+	}
+	return result
+}
+
+func (a *announcer) url(host string) string {
+	if (a.scheme == "http" && a.port == 80) || (a.scheme == "https" && a.port == 443) {
+		return a.scheme + "://" + host
+	}
+	return a.scheme + "://" + net.JoinHostPort(host, strconv.Itoa(a.port))
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-tunnel/services"
+	"go-tunnel/tunnel"
+)
+
+const (
+	// heartbeatInterval - node o'z tunnellarini reyestrda shu oraliqda yangilaydi
+	heartbeatInterval = 10 * time.Second
+	// sessionMaxAge - shundan eski yozuvlar o'chgan node hisoblanadi
+	sessionMaxAge = 3 * heartbeatInterval
+)
+
+// ClusterNode - tunnelni ushlab turgan node
+type ClusterNode struct {
+	ID   string
+	Addr string
+}
+
+// ClusterStore - nodelar o'rtasidagi umumiy tunnel reyestri. owner - nomni
+// ushlab turgan client sessiyasi (ownerKey), anonim tunnelda bo'sh.
+type ClusterStore interface {
+	Announce(name string, node ClusterNode, owner string) error
+	Withdraw(name, nodeID string) error
+	Nodes(name string) ([]ClusterNode, error)
+	// Owner boshqa node'larda jonli nom egasini qaytaradi ("" - yo'q)
+	Owner(name, exceptNodeID string) (string, error)
+}
+
+// dbClusterStore - tunnel_sessions jadvali orqali reyestr (Postgres/MySQL)
+type dbClusterStore struct{}
+
+func (dbClusterStore) Announce(name string, node ClusterNode, owner string) error {
+	return services.AnnounceTunnelSession(name, node.ID, node.Addr, owner)
+}
+
+func (dbClusterStore) Withdraw(name, nodeID string) error {
+	return services.WithdrawTunnelSession(name, nodeID)
+}
+
+func (dbClusterStore) Nodes(name string) ([]ClusterNode, error) {
+	sessions, err := services.TunnelSessionNodes(name, sessionMaxAge)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]ClusterNode, 0, len(sessions))
+	for _, session := range sessions {
+		nodes = append(nodes, ClusterNode{ID: session.NodeID, Addr: session.NodeAddr})
+	}
+	return nodes, nil
+}
+
+func (dbClusterStore) Owner(name, exceptNodeID string) (string, error) {
+	return services.TunnelSessionOwner(name, exceptNodeID, sessionMaxAge)
+}
+
+// cluster - bir nechta server node'lari: tunnel boshqa node'da bo'lsa
+// tashqi ulanish o'sha node'ga uzatiladi
+type cluster struct {
+	self    ClusterNode
+	secret  string
+	store   ClusterStore
+	tunnels *registry
+
+	mu        sync.Mutex
+	announced map[string]string // e'lon qilingan nom -> egasi
+}
+
+func newCluster(self ClusterNode, secret string, store ClusterStore, tunnels *registry) *cluster {
+	return &cluster{
+		self:      self,
+		secret:    secret,
+		store:     store,
+		tunnels:   tunnels,
+		announced: make(map[string]string),
+	}
+}
+
+// heartbeat jonli tunnellarni reyestrga e'lon qiladi
+func (c *cluster) heartbeat() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		c.announce()
+		<-ticker.C
+	}
+}
+
+func (c *cluster) announce() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	live := c.tunnels.liveTunnels()
+	for name, owner := range live {
+		if err := c.store.Announce(name, c.self, owner); err != nil {
+			monitor.Error("Cluster e'loni (%q): %v", name, err)
+			continue
+		}
+		c.announced[name] = owner
+	}
+	for name := range c.announced {
+		if _, ok := live[name]; ok {
+			continue
+		}
+		if err := c.store.Withdraw(name, c.self.ID); err != nil {
+			monitor.Error("Cluster e'loni (%q): %v", name, err)
+			continue
+		}
+		delete(c.announced, name)
+	}
+}
+
+// claim nomni butun cluster bo'yicha owner ga bog'laydi: boshqa node'da
+// boshqa sessiya ushlab turgan nom errNameInUse. Ikki node bir vaqtda
+// tekshirsa ikkalasi ham o'tishi mumkin, lekin keyingi ulanishlar (har
+// heartbeat'da yangilanadigan yozuv bo'yicha) rad etiladi.
+func (c *cluster) claim(name, owner string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if announced, ok := c.announced[name]; ok && announced == owner {
+		return nil
+	}
+	other, err := c.store.Owner(name, c.self.ID)
+	if err != nil {
+		return fmt.Errorf("cluster reyestri: %w", err)
+	}
+	if other != "" && other != owner {
+		return errNameInUse
+	}
+	if err := c.store.Announce(name, c.self, owner); err != nil {
+		return fmt.Errorf("cluster reyestri: %w", err)
+	}
+	c.announced[name] = owner
+	return nil
+}
+
+// withdrawAll server to'xtaganda barcha yozuvlarni o'chiradi
+func (c *cluster) withdrawAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for name := range c.announced {
+		c.store.Withdraw(name, c.self.ID)
+	}
+	c.announced = make(map[string]string)
+}
+
+// forward ulanishni tunnelni ushlab turgan boshqa node'ga uzatadi.
+// Mos node topilmasa false qaytaradi.
+func (c *cluster) forward(id int64, name string, user net.Conn) bool {
+	nodes, err := c.store.Nodes(name)
+	if err != nil {
+		monitor.Error("[Req #%d] Cluster reyestri: %v", id, err)
+		return false
+	}
+
+	for _, node := range nodes {
+		if node.ID == c.self.ID {
+			continue
+		}
+
+		conn, err := net.DialTimeout("tcp", node.Addr, 3*time.Second)
+		if err != nil {
+			monitor.Error("[Req #%d] %s node'ga ulanib bo'lmadi: %v", id, node.ID, err)
+			continue
+		}
+		header := tunnel.Forward{Name: name, Secret: c.secret, Remote: user.RemoteAddr().String()}
+		if err := tunnel.WriteMessage(conn, header); err != nil {
+			conn.Close()
+			continue
+		}
+
+		fmt.Printf("[Req #%d] %q tunneli %s node'ga uzatildi\n", id, name, node.ID)
+		handleTraffic(id, user, conn)
+		return true
+	}
+	return false
+}
+
+// serve boshqa node'lardan uzatilgan ulanishlarni qabul qiladi
+func (c *cluster) serve(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go c.handleForwarded(conn)
+	}
+}
+
+func (c *cluster) handleForwarded(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+
+	conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	var header tunnel.Forward
+	err := tunnel.ReadMessage(reader, &header)
+	conn.SetReadDeadline(time.Time{})
+	// Bo'sh kalit hech qachon mos kelmaydi (main ham bo'sh kalit bilan ishga tushmaydi)
+	if err != nil || c.secret == "" || subtle.ConstantTimeCompare([]byte(header.Secret), []byte(c.secret)) != 1 {
+		monitor.Error("Cluster: noto'g'ri uzatish so'rovi (%s)", conn.RemoteAddr())
+		conn.Close()
+		return
+	}
+
+	id := atomic.AddInt64(&connectionCounter, 1)
+	fmt.Printf("[Req #%d] Cluster orqali ulanish: %s (%s)\n", id, header.Remote, conn.RemoteAddr())
+
+	// Uzatilgan ulanish qayta uzatilmaydi (aylanib qolmaslik uchun)
+	user := tunnel.NewBufferedConn(conn, reader)
+	if tunnelConn := c.tunnels.take(header.Name); tunnelConn != nil {
+		handleTraffic(id, user, tunnelConn)
+		return
+	}
+	rejectUnavailable(id, user)
+}
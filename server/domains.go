@@ -0,0 +1,165 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// domainCacheTTL - custom domen natijalari har so'rovda bazaga bormasligi uchun
+const domainCacheTTL = time.Minute
+
+// maxCacheEntries - keshdagi yozuvlar chegarasi; to'lsa eng uzoq
+// ishlatilmagani chiqariladi (LRU)
+const maxCacheEntries = 10000
+
+// lruCache - muddati (TTL) va hajmi cheklangan kesh. Muddati o'tgan yozuv
+// o'qilganda o'chiriladi.
+type lruCache[V any] struct {
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // oldinda - oxirgi ishlatilgani
+	ttl     time.Duration
+	max     int
+}
+
+type lruEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+}
+
+func newLRUCache[V any](ttl time.Duration, max int) *lruCache[V] {
+	return &lruCache[V]{entries: make(map[string]*list.Element), order: list.New(), ttl: ttl, max: max}
+}
+
+func (c *lruCache[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	element, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+	entry := element.Value.(*lruEntry[V])
+	if !time.Now().Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return zero, false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+func (c *lruCache[V]) put(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := time.Now().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		element.Value = &lruEntry[V]{key: key, value: value, expires: expires}
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry[V]{key: key, value: value, expires: expires})
+	for c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry[V]).key)
+	}
+}
+
+type domainEntry struct {
+	name string
+	ok   bool
+}
+
+// domainCache tasdiqlangan custom domenlarni (dev.customer.com -> alice)
+// keshlaydi. Host sarlavhasini istalgan client yuboradi, shuning uchun
+// bazaga faqat tasdiqlangan domenlar ro'yxatida bor hostlar uchun
+// murojaat qilinadi; ro'yxat o'zi domainCacheTTL da bir marta yangilanadi.
+type domainCache struct {
+	entries *lruCache[domainEntry]
+	lookup  func(domain string) (string, bool, error)
+
+	known     func() ([]string, error)
+	knownMu   sync.Mutex
+	knownSet  map[string]bool
+	knownTime time.Time
+}
+
+func newDomainCache(lookup func(domain string) (string, bool, error), known func() ([]string, error)) *domainCache {
+	return &domainCache{
+		entries: newLRUCache[domainEntry](domainCacheTTL, maxCacheEntries),
+		lookup:  lookup,
+		known:   known,
+	}
+}
+
+func (c *domainCache) tunnelFor(host string) (string, bool) {
+	if entry, cached := c.entries.get(host); cached {
+		return entry.name, entry.ok
+	}
+	if !c.isKnown(host) {
+		return "", false
+	}
+
+	name, ok, err := c.lookup(host)
+	if err != nil {
+		monitor.Error("Custom domen tekshiruvi (%s): %v", host, err)
+		return "", false
+	}
+	c.entries.put(host, domainEntry{name: name, ok: ok})
+	return name, ok
+}
+
+// isKnown host tasdiqlangan custom domenlar ro'yxatidami; ro'yxatni
+// o'qib bo'lmasa eski ro'yxat ishlatiladi
+func (c *domainCache) isKnown(host string) bool {
+	c.knownMu.Lock()
+	defer c.knownMu.Unlock()
+
+	if time.Since(c.knownTime) >= domainCacheTTL {
+		// Xato bo'lsa ham vaqt yangilanadi: baza ishlamasa har so'rovda urinmaymiz
+		c.knownTime = time.Now()
+		domains, err := c.known()
+		if err != nil {
+			monitor.Error("Custom domenlar ro'yxati: %v", err)
+		} else {
+			c.knownSet = make(map[string]bool, len(domains))
+			for _, domain := range domains {
+				c.knownSet[domain] = true
+			}
+		}
+	}
+	return c.knownSet[host]
+}
+
+// tunnelDomainsCache tunnelning tasdiqlangan custom domenlarini keshlaydi:
+// zaxiradagi har bir ulanish hello yuborganda bazaga so'rov ketmasligi uchun
+type tunnelDomainsCache struct {
+	entries *lruCache[[]string]
+	lookup  func(name string) ([]string, error)
+}
+
+func newTunnelDomainsCache(lookup func(name string) ([]string, error)) *tunnelDomainsCache {
+	return &tunnelDomainsCache{
+		entries: newLRUCache[[]string](domainCacheTTL, maxCacheEntries),
+		lookup:  lookup,
+	}
+}
+
+// domainsFor announcer.customDomains sifatida ishlatiladi; xatolar keshlanmaydi
+func (c *tunnelDomainsCache) domainsFor(name string) ([]string, error) {
+	if domains, cached := c.entries.get(name); cached {
+		return domains, nil
+	}
+
+	domains, err := c.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	c.entries.put(name, domains)
+	return domains, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"time"
+)
+
+// maxHeaderPeek - Host sarlavhasini qidirish uchun o'qiladigan maksimal hajm
+const maxHeaderPeek = 16 * 1024
+
+const (
+	// firstByteTimeout - HTTP client ulanishi bilan so'rov yuboradi. Shu vaqt
+	// ichida hech narsa kelmasa bu server birinchi gapiradigan TCP protokol
+	// (SMTP, SSH, ...) - Host kutilmaydi.
+	firstByteTimeout = time.Second
+	// headerTimeout - HTTP so'rov boshlangandan keyin sarlavhalarni kutish
+	headerTimeout = 10 * time.Second
+)
+
+// peekHost HTTP so'rov sarlavhalaridan Host ni o'qiydi, baytlarni iste'mol qilmasdan.
+// Reader orqali o'qilgan hamma narsa keyin tunnelga uzatiladi. HTTP ga
+// o'xshamagan oqim (xom TCP, TLS) kutilmasdan "" host bilan qaytadi.
+func peekHost(conn net.Conn) (string, *bufio.Reader) {
+	reader := bufio.NewReaderSize(conn, maxHeaderPeek)
+	defer conn.SetReadDeadline(time.Time{})
+
+	conn.SetReadDeadline(time.Now().Add(firstByteTimeout))
+	if _, err := reader.Peek(1); err != nil {
+		return "", reader
+	}
+
+	conn.SetReadDeadline(time.Now().Add(headerTimeout))
+	for {
+		data := peekBuffered(reader)
+		if !looksLikeHTTP(data) {
+			return "", reader
+		}
+		if end := bytes.Index(data, []byte("\r\n\r\n")); end >= 0 {
+			return hostFromHeaders(data[:end]), reader
+		}
+		// Buferdagidan kamida bitta bayt ko'proq kutamiz
+		if _, err := reader.Peek(reader.Buffered() + 1); err != nil {
+			// EOF, timeout yoki bufer to'ldi - Host topilmadi
+			return "", reader
+		}
+	}
+}
+
+func peekBuffered(reader *bufio.Reader) []byte {
+	data, _ := reader.Peek(reader.Buffered())
+	return data
+}
+
+// looksLikeHTTP - oqim boshi HTTP so'rov qatoriga o'xshaydimi ("GET ",
+// "PROPFIND " ...); hali to'liq kelmagan metod ham true
+func looksLikeHTTP(data []byte) bool {
+	for i, c := range data {
+		switch {
+		case c == ' ':
+			return i > 0
+		case c < 'A' || c > 'Z' || i >= 16:
+			return false
+		}
+	}
+	return true
+}
+
+func hostFromHeaders(headers []byte) string {
+	for _, line := range strings.Split(string(headers), "\r\n")[1:] {
+		key, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), "Host") {
+			host := strings.ToLower(strings.TrimSpace(value))
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			return host
+		}
+	}
+	return ""
+}
+
+// hostRouter Host sarlavhasini tunnel nomiga aylantiradi
+type hostRouter struct {
+	domain  string       // tunnel domeni: alice.<domain> -> alice
+	domains *domainCache // tasdiqlangan custom domenlar, bazasiz rejimda nil
+}
+
+// tunnelFor hostga mos tunnel nomini qaytaradi ("" - anonim tunnel).
+// ok=false bo'lsa host hech qaysi tunnelga tegishli emas.
+func (h *hostRouter) tunnelFor(host string) (string, bool) {
+	if host == "" || host == h.domain || net.ParseIP(host) != nil {
+		return "", true
+	}
+	if name, found := strings.CutSuffix(host, "."+h.domain); found && h.domain != "" {
+		if strings.Contains(name, ".") {
+			return "", false
+		}
+		return name, true
+	}
+	if h.domains != nil {
+		return h.domains.tunnelFor(host)
+	}
+	return "", h.domain == ""
+}
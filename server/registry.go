@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-tunnel/services"
+	"go-tunnel/tunnel"
+)
+
+// helloTimeout - eski clientlar hello yubormaydi, shuncha kutib anonim tunnel deb qabul qilamiz
+const helloTimeout = 2 * time.Second
+
+// poolSize - har bir tunnel uchun saqlanadigan bo'sh ulanishlar chegarasi
+const poolSize = 100
+
+// errNameInUse - nom boshqa client sessiyasida ishlatilmoqda
+var errNameInUse = errors.New("tunnel nomi boshqa client tomonidan ishlatilmoqda")
+
+// errNoDomain - serverda -domain ham, custom domenlar ham yo'q: nomli
+// tunnelga hech qanday so'rov yetib bormaydi
+var errNoDomain = errors.New("serverda tunnel domeni sozlanmagan, -name ishlatib bo'lmaydi")
+
+// Authorizer tunnel nomidan foydalanish huquqini tekshiradi
+type Authorizer interface {
+	Authorize(name, token string) error
+}
+
+// openAuthorizer - bazasiz rejim: istalgan nom ruxsat etiladi
+type openAuthorizer struct{}
+
+func (openAuthorizer) Authorize(name, token string) error { return nil }
+
+// jwtAuthorizer - bazasiz, JWT sozlangan edge node: nomli tunnel uchun shu
+// nomni "tunnels" claim'ida ko'rsatgan JWT kerak
+type jwtAuthorizer struct{}
+
+func (jwtAuthorizer) Authorize(name, token string) error {
+	return services.AuthorizeTunnelNameJWT(name, token)
+}
+
+// dbAuthorizer - band qilingan nomlarni (reserved_domains) bazadan tekshiradi
+type dbAuthorizer struct{}
+
+func (dbAuthorizer) Authorize(name, token string) error {
+	return services.AuthorizeTunnelName(name, token)
+}
+
+// owner - jonli tunnel nomining egasi (birinchi ulangan sessiya) va uning
+// ochiq ulanishlari soni; oxirgi ulanish yopilganda nom bo'shaydi
+type owner struct {
+	key   string
+	conns int
+}
+
+// registry - har bir tunnel nomi uchun bo'sh ulanishlar zaxirasi
+type registry struct {
+	mu       sync.Mutex
+	pools    map[string]chan *trackedConn
+	owners   map[string]*owner
+	auth     Authorizer
+	compress bool       // client taklif qilsa tunnel trafigini siqish
+	announce *announcer // clientga public URL va limitlarni yuborish
+	// minVersion - qabul qilinadigan eng eski protokol versiyasi
+	minVersion int
+	// named - so'rovlar nom bo'yicha yo'naltiriladimi (-domain yoki custom
+	// domenlar); aks holda hamma so'rov "" tunneliga boradi
+	named bool
+	// cluster - nom egaligini boshqa node'lar bilan tekshirish (cluster
+	// rejimida), aks holda nil
+	cluster *cluster
+}
+
+func newRegistry(auth Authorizer, compress bool, announce *announcer, minVersion int, named bool) *registry {
+	return &registry{
+		pools:      map[string]chan *trackedConn{"": make(chan *trackedConn, poolSize)},
+		owners:     map[string]*owner{},
+		auth:       auth,
+		compress:   compress,
+		announce:   announce,
+		minVersion: minVersion,
+		named:      named,
+	}
+}
+
+// pool nom uchun zaxirani qaytaradi; create=false bo'lsa mavjud bo'lmasa nil
+func (r *registry) pool(name string, create bool) chan *trackedConn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pool, ok := r.pools[name]
+	if !ok && create {
+		pool = make(chan *trackedConn, poolSize)
+		r.pools[name] = pool
+	}
+	return pool
+}
+
+// take nom uchun bo'sh tunnel ulanishini oladi, bo'lmasa nil
+func (r *registry) take(name string) net.Conn {
+	pool := r.pool(name, false)
+	if pool == nil {
+		return nil
+	}
+	for {
+		select {
+		case conn := <-pool:
+			// Kutish paytida client uzilgan bo'lsa keyingisini olamiz
+			if !conn.stopWatching() {
+				continue
+			}
+			monitor.TunnelTaken()
+			return tunnel.Wrap(conn, conn.compression)
+		default:
+			return nil
+		}
+	}
+}
+
+// claim nomni key egasiga bog'laydi yoki uning ulanishlari sonini oshiradi;
+// nom boshqa sessiyada jonli bo'lsa errNameInUse. Anonim ("") tunnel hech
+// kimga bog'lanmaydi: uni bir nechta client birgalikda ishlatadi.
+func (r *registry) claim(name, key string) error {
+	if name == "" {
+		return nil
+	}
+	r.mu.Lock()
+	o, ok := r.owners[name]
+	switch {
+	case ok && o.key == key:
+		o.conns++
+		r.mu.Unlock()
+		return nil
+	case ok:
+		r.mu.Unlock()
+		return errNameInUse
+	}
+	r.mu.Unlock()
+
+	// Nom bu node'da yangi: boshqa node'larda ham egasi boshqa bo'lmasin
+	if r.cluster != nil {
+		if err := r.cluster.claim(name, key); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok = r.owners[name]
+	switch {
+	case !ok:
+		r.owners[name] = &owner{key: key, conns: 1}
+	case o.key == key:
+		o.conns++
+	default:
+		// Tekshiruv paytida boshqa sessiya shu node'da egallab oldi
+		return errNameInUse
+	}
+	return nil
+}
+
+// liveTunnels cluster'ga e'lon qilinadigan tunnellar va egalari: nomli
+// tunnel egasining ulanishi bor ekan, anonim tunnel bo'sh ulanishi bor ekan
+func (r *registry) liveTunnels() map[string]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	live := make(map[string]string, len(r.owners)+1)
+	for name, o := range r.owners {
+		live[name] = o.key
+	}
+	if len(r.pools[""]) > 0 {
+		live[""] = ""
+	}
+	return live
+}
+
+// release claim qilingan ulanish yopilganda chaqiriladi
+func (r *registry) release(name string) {
+	if name == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if o, ok := r.owners[name]; ok {
+		o.conns--
+		if o.conns <= 0 {
+			delete(r.owners, name)
+		}
+	}
+}
+
+// prune zaxiradan yopilgan ulanishlarni chiqarib tashlaydi, aks holda ular
+// take qilinguncha joy egallab turadi
+func (r *registry) prune(name string) {
+	pool := r.pool(name, false)
+	for i := len(pool); i > 0; i-- {
+		select {
+		case conn := <-pool:
+			if conn.closed.Load() {
+				continue
+			}
+			select {
+			case pool <- conn:
+			default:
+				// Shu orada yangi ulanishlar zaxirani to'ldirgan
+				conn.stopWatching()
+				monitor.TunnelTaken()
+				conn.Close()
+			}
+		default:
+			return
+		}
+	}
+}
+
+// ownerKey - nom kimga bog'lanadi: client sessiyasi, sessiya yubormaydigan
+// eski clientlarda token, u ham bo'lmasa IP manzil. Kalit cluster
+// reyestriga ham yoziladi, shuning uchun token ochiq saqlanmasin - hash.
+func ownerKey(hello tunnel.Hello, conn net.Conn) string {
+	var key string
+	switch {
+	case hello.Session != "":
+		key = "session:" + hello.Session
+	case hello.Token != "":
+		key = "token:" + hello.Token
+	default:
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		key = "addr:" + host
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// accept hello ni tekshiradi: protokol versiyasi, tunnel nomiga huquq,
+// so'ng versiya, imkoniyatlar (features) va siqishni kelishadi. Rad etilsa
+// clientga yuboriladigan javob va xato qaytadi.
+func (r *registry) accept(hello tunnel.Hello, conn net.Conn) (tunnel.HelloResult, error) {
+	protocol, err := tunnel.NegotiateVersion(hello.ProtocolVersion(), r.minVersion)
+	if err != nil {
+		return tunnel.HelloResult{Error: err.Error(), Code: tunnel.CodeIncompatible, ServerVersion: version}, err
+	}
+	if hello.Name != "" && !r.named {
+		return tunnel.HelloResult{Error: errNoDomain.Error(), Code: tunnel.CodeNameUnavailable}, errNoDomain
+	}
+	if err := r.auth.Authorize(hello.Name, hello.Token); err != nil {
+		return tunnel.HelloResult{Error: err.Error(), Code: tunnel.CodeUnauthorized}, err
+	}
+
+	features := tunnel.NegotiateFeatures(hello.OfferedFeatures())
+	result := tunnel.HelloResult{OK: true, Features: features}
+	// v1 serverlar versiya yubormagan, v1 clientlarga ham shunday javob beramiz
+	if hello.Version != 0 {
+		result.Version = protocol
+		result.ServerVersion = version
+	}
+	if tunnel.HasFeature(features, tunnel.FeatureCompression) {
+		result.Compression = tunnel.NegotiateCompression(hello.Compression, r.compress)
+	}
+	if tunnel.HasFeature(features, tunnel.FeatureRegistration) {
+		result.Registration = r.announce.registration(hello.Name, conn)
+	}
+	return result, nil
+}
+
+// register client ulanishidan hello o'qiydi, huquqni tekshiradi va zaxiraga qo'shadi
+func (r *registry) register(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+
+	conn.SetReadDeadline(time.Now().Add(helloTimeout))
+	var hello tunnel.Hello
+	err := tunnel.ReadMessage(reader, &hello)
+	conn.SetReadDeadline(time.Time{})
+
+	var netErr net.Error
+	compression := ""
+	switch {
+	case errors.As(err, &netErr) && netErr.Timeout() && reader.Buffered() == 0:
+		// Eski client: hello yo'q, anonim tunnel (protokol v1)
+		if r.minVersion > 1 {
+			fmt.Printf("Eski client rad etildi (%s): hello yo'q, protokol v1\n", conn.RemoteAddr())
+			monitor.Error("Eski client rad etildi (%s): hello yo'q, protokol v1", conn.RemoteAddr())
+			conn.Close()
+			return
+		}
+		hello = tunnel.Hello{}
+	case err != nil:
+		monitor.Error("Hello o'qib bo'lmadi (%s): %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	default:
+		result, err := r.accept(hello, conn)
+		if err == nil {
+			// Nom (band qilinmagan bo'lsa ham) birinchi sessiyaga tegishli
+			if err = r.claim(hello.Name, ownerKey(hello, conn)); err != nil {
+				result = tunnel.HelloResult{Error: err.Error(), Code: tunnel.CodeNameUnavailable}
+			}
+		}
+		if err != nil {
+			fmt.Printf("Tunnel rad etildi (%s, %q, client %s): %v\n", conn.RemoteAddr(), hello.Name, hello.ClientVersion, err)
+			monitor.Error("Tunnel rad etildi (%s, %q): %v", conn.RemoteAddr(), hello.Name, err)
+			tunnel.WriteMessage(conn, result)
+			conn.Close()
+			return
+		}
+		if err := tunnel.WriteMessage(conn, result); err != nil {
+			r.release(hello.Name)
+			conn.Close()
+			return
+		}
+		compression = result.Compression
+	}
+
+	pool := r.pool(hello.Name, true)
+	monitor.ClientConnected(conn.RemoteAddr())
+	tracked := &trackedConn{
+		BufferedConn: tunnel.NewBufferedConn(conn, reader),
+		registry:     r,
+		name:         hello.Name,
+		compression:  compression,
+		watched:      make(chan struct{}),
+	}
+	select {
+	case pool <- tracked:
+		go tracked.watch()
+	default:
+		close(tracked.watched)
+		monitor.TunnelTaken()
+		fmt.Fprintf(os.Stderr, "Tunnel zaxirasi to'la (%q), ulanish yopildi\n", hello.Name)
+		tracked.Close()
+	}
+}
+
+// pastDeadline - kutayotgan o'qishni darhol to'xtatish uchun
+var pastDeadline = time.Unix(1, 0)
+
+// trackedConn - zaxiradagi client ulanishi. Bo'sh turganda watch client
+// uzilganini kuzatadi; yopilganda monitoringga bildiradi va nomni bo'shatadi
+type trackedConn struct {
+	*tunnel.BufferedConn
+	registry    *registry
+	name        string
+	compression string
+
+	watched chan struct{} // watch tugaganda yopiladi
+	closed  atomic.Bool
+	once    sync.Once
+}
+
+// watch bo'sh ulanishdan bir bayt kutadi: client bo'sh ulanishga hech narsa
+// yozmaydi, shuning uchun EOF yoki xato - client uzilgan
+func (c *trackedConn) watch() {
+	defer close(c.watched)
+	_, err := c.Peek(1)
+	var netErr net.Error
+	if err != nil && !(errors.As(err, &netErr) && netErr.Timeout()) {
+		monitor.TunnelTaken()
+		c.Close()
+		c.registry.prune(c.name)
+	}
+}
+
+// stopWatching watch ni to'xtatadi, shundan keyin ulanishni stream uchun
+// o'qish mumkin; client uzilgan bo'lsa false
+func (c *trackedConn) stopWatching() bool {
+	c.SetReadDeadline(pastDeadline)
+	<-c.watched
+	c.SetReadDeadline(time.Time{})
+	return !c.closed.Load()
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.closed.Store(true)
+		monitor.ClientDisconnected(c.RemoteAddr())
+		c.registry.release(c.name)
+	})
+	return c.BufferedConn.Close()
+}
@@ -1,106 +1,292 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync/atomic"
 	"syscall"
+
+	"github.com/joho/godotenv"
+
+	"go-tunnel/services"
+	"go-tunnel/tunnel"
 )
 
 var connectionCounter int64
 
+// monitor - admin panel uchun server holati
+var monitor = tunnel.NewMonitor()
+
 func main() {
-        sigs := make(chan os.Signal, 1)
-        signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-
-        controlListener, err := net.Listen("tcp", "0.0.0.0:9000")
-        if err != nil {
-                fmt.Printf("Control xatosi: %v\n", err)
-                os.Exit(1)
-        }
-
-        externalListener, err := net.Listen("tcp", "0.0.0.0:8000")
-        if err != nil {
-                fmt.Printf("External xatosi: %v\n", err)
-                os.Exit(1)
-        }
-
-        fmt.Println("============================================")
-        fmt.Println("NGROK CLONE SERVER ISHGA TUSHDI")
-        fmt.Println("Control Port (Client uchun): 9000")
-        fmt.Println("Public Port (Brauzer uchun): 8000")
-        fmt.Println("============================================")
-
-        tunnels := make(chan net.Conn, 100)
-
-        // Tunnel zaxirasini yig'ish
-        go func() {
-                for {
-                        conn, err := controlListener.Accept()
-                        if err != nil {
-                                return
-                        }
-                        tunnels <- conn
-                }
-        }()
-
-        // Tashqi so'rovlarni boshqarish
-        go func() {
-           for {
-                        userConn, err := externalListener.Accept()
-                        if err != nil {
-                                return
-                        }
-
-                        id := atomic.AddInt64(&connectionCounter, 1)
-                        fmt.Printf("[Req #%d] Yangi ulanish: %s\n", id, userConn.RemoteAddr())
-
-                        select {
-                        case tunnelConn := <-tunnels:
-                                go handleTraffic(id, userConn, tunnelConn)
-                        default:
-                                fmt.Printf("[Req #%d] XATO: Bo'sh tunnel yo'q!\n", id)
-                                userConn.Write([]byte("HTTP/1.1 503 Service Unavailable\r\n\r\nZaxirada tunnel yo'q."))
-                                userConn.Close()
-                        }
-                }
-        }()
-
-        <-sigs
-        fmt.Println("\nServer to'xtatilmoqda...")
+	controlAddr := flag.String("control", "0.0.0.0:9000", "Control manzili (Client uchun)")
+	publicAddr := flag.String("public", "0.0.0.0:8000", "Public manzil (Brauzer uchun)")
+	adminAddr := flag.String("admin", "127.0.0.1:9100", "Monitoring (stats/events) manzili, bo'sh bo'lsa o'chiriladi")
+	domain := flag.String("domain", "", "Tunnel domeni (alice.<domain> -> alice tunneli), bo'sh bo'lsa Host tekshirilmaydi")
+	useDB := flag.Bool("db", false, "Band qilingan nomlar va custom domenlarni bazadan tekshirish (.env kerak)")
+	compress := flag.Bool("compress", true, "Client bilan trafikni siqish (deflate), client taklif qilsa")
+	clusterListen := flag.String("cluster-listen", "", "Cluster rejimi (-db va -cluster-secret bilan): boshqa node'lardan uzatilgan ulanishlar manzili (masalan 0.0.0.0:9200)")
+	advertise := flag.String("advertise", "", "Boshqa node'lar shu node'ga ulanadigan manzil (standart: -cluster-listen)")
+	nodeID := flag.String("node-id", "", "Cluster'dagi node nomi (standart: hostname)")
+	publicScheme := flag.String("public-scheme", "http", "Clientga e'lon qilinadigan URL sxemasi (server TLS proxy orqasida bo'lsa https)")
+	publicURLPort := flag.Int("public-url-port", 0, "Clientga e'lon qilinadigan URL porti (standart: -public porti)")
+	minProtocol := flag.Int("min-protocol", tunnel.MinProtocolVersion, "Qabul qilinadigan eng eski client protokoli (1 - hello siz eski clientlar ham)")
+	clusterSecret := flag.String("cluster-secret", os.Getenv("TUNNEL_CLUSTER_SECRET"), "Node'lar o'rtasidagi umumiy maxfiy kalit")
+	flag.Parse()
+
+	if *minProtocol < tunnel.MinProtocolVersion || *minProtocol > tunnel.ProtocolVersion {
+		fmt.Printf("XATO: -min-protocol %d..%d oralig'ida bo'lishi kerak\n", tunnel.MinProtocolVersion, tunnel.ProtocolVersion)
+		os.Exit(1)
+	}
+
+	// Cluster reyestri bazada turadi: bazasiz node'lar bir-birining
+	// tunnellarini ko'rmaydi. Uzatish porti esa kalitsiz ochiq qolmasligi kerak.
+	if *clusterListen != "" && !*useDB {
+		fmt.Println("XATO: -cluster-listen uchun -db kerak (node'lar tunnel reyestrini bazada bo'lishadi)")
+		os.Exit(1)
+	}
+	if *clusterListen != "" && *clusterSecret == "" {
+		fmt.Println("XATO: -cluster-listen uchun -cluster-secret (yoki TUNNEL_CLUSTER_SECRET) kerak")
+		os.Exit(1)
+	}
+
+	var auth Authorizer = openAuthorizer{}
+	hosts := &hostRouter{domain: strings.ToLower(*domain)}
+	announce := newAnnouncer(*publicAddr, *publicScheme, *publicURLPort, hosts.domain)
+	if *useDB {
+		services.ConnectDatabase()
+	} else {
+		// .env ixtiyoriy: bazasiz edge node JWT sozlamalarini shundan oladi
+		godotenv.Load()
+	}
+	// JWT tokenlar bazaga so'rovsiz tekshiriladi (JWT_KEYS yoki JWT_JWKS_URL)
+	if err := services.InitJWT(); err != nil {
+		fmt.Printf("XATO: JWT sozlamalari: %v\n", err)
+		os.Exit(1)
+	}
+	if !*useDB && services.JWTEnabled() {
+		auth = jwtAuthorizer{}
+	}
+	if *useDB {
+		auth = dbAuthorizer{}
+		hosts.domains = newDomainCache(services.TunnelForCustomDomain, services.VerifiedCustomDomains)
+		announce.customDomains = newTunnelDomainsCache(services.VerifiedDomainsForTunnel).domainsFor
+	}
+	tunnels := newRegistry(auth, *compress, announce, *minProtocol, hosts.domain != "" || hosts.domains != nil)
+
+	// Cluster rejimi: tunnel reyestri bazada (tunnel_sessions)
+	var nodes *cluster
+	if *clusterListen != "" {
+		self := ClusterNode{ID: *nodeID, Addr: *advertise}
+		if self.ID == "" {
+			self.ID, _ = os.Hostname()
+		}
+		if self.Addr == "" {
+			self.Addr = *clusterListen
+		}
+		nodes = newCluster(self, *clusterSecret, dbClusterStore{}, tunnels)
+		tunnels.cluster = nodes
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	controlListener, err := net.Listen("tcp", *controlAddr)
+	if err != nil {
+		fmt.Printf("Control xatosi: %v\n", err)
+		os.Exit(1)
+	}
+
+	externalListener, err := net.Listen("tcp", *publicAddr)
+	if err != nil {
+		fmt.Printf("External xatosi: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("============================================")
+	fmt.Printf("NGROK CLONE SERVER ISHGA TUSHDI (%s)\n", version)
+	if commit != "" {
+		fmt.Printf("Build: commit %s, %s\n", commit, date)
+	}
+	fmt.Printf("Protokol: v%d..v%d\n", *minProtocol, tunnel.ProtocolVersion)
+	fmt.Printf("Control Port (Client uchun): %s\n", *controlAddr)
+	fmt.Printf("Public Port (Brauzer uchun): %s\n", *publicAddr)
+	if *domain != "" {
+		fmt.Printf("Tunnel domeni: *.%s\n", *domain)
+	}
+	if nodes != nil {
+		fmt.Printf("Cluster node: %s (%s)\n", nodes.self.ID, nodes.self.Addr)
+	}
+	if *adminAddr != "" {
+		fmt.Printf("Monitoring (Admin panel uchun): %s\n", *adminAddr)
+	}
+	fmt.Println("============================================")
+
+	// Monitoring: /stats (JSON) va /events (SSE)
+	if *adminAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(*adminAddr, monitor.Handler()); err != nil {
+				fmt.Printf("Monitoring xatosi: %v\n", err)
+			}
+		}()
+	}
+
+	if nodes != nil {
+		clusterListener, err := net.Listen("tcp", *clusterListen)
+		if err != nil {
+			fmt.Printf("Cluster xatosi: %v\n", err)
+			os.Exit(1)
+		}
+		go nodes.serve(clusterListener)
+		go nodes.heartbeat()
+	}
+
+	// Tunnel zaxirasini yig'ish
+	go func() {
+		for {
+			conn, err := controlListener.Accept()
+			if err != nil {
+				return
+			}
+			go tunnels.register(conn)
+		}
+	}()
+
+	// Tashqi so'rovlarni boshqarish
+	go func() {
+		for {
+			userConn, err := externalListener.Accept()
+			if err != nil {
+				return
+			}
+
+			id := atomic.AddInt64(&connectionCounter, 1)
+			fmt.Printf("[Req #%d] Yangi ulanish: %s\n", id, userConn.RemoteAddr())
+
+			go routeConnection(id, userConn, tunnels, hosts, nodes)
+		}
+	}()
+
+	<-sigs
+	fmt.Println("\nServer to'xtatilmoqda...")
+	if nodes != nil {
+		nodes.withdrawAll()
+	}
 }
 
-func handleTraffic(id int64, user, tunnel net.Conn) {
-        defer user.Close()
-        defer tunnel.Close()
-
-        // Ma'lumot hajmini hisoblash uchun wrapper
-        copyAndLog := func(dst io.Writer, src io.Reader, direction string) {
-                n, _ := io.Copy(dst, src)
-                if n > 0 {
-                        fmt.Printf("[Req #%d] %s: %d bytes uzatildi\n", id, direction, n)
-                }
-        }
-
-        done := make(chan struct{}, 2)
-
-        // Request (User -> Tunnel -> Laravel)
-        go func() {
-                copyAndLog(tunnel, user, "REQUEST ")
-                done <- struct{}{}
-        }()
-
-        // Response (Laravel -> Tunnel -> User)
-        go func() {
-                copyAndLog(user, tunnel, "RESPONSE")
-                done <- struct{}{}
-        }()
-
-        <-done
-        fmt.Printf("[Req #%d] Ulanish yakunlandi.\n", id)
+// routeConnection tashqi ulanishni Host bo'yicha kerakli tunnelga yo'naltiradi
+func routeConnection(id int64, userConn net.Conn, tunnels *registry, hosts *hostRouter, nodes *cluster) {
+	var user net.Conn = userConn
+	name, known := "", true
+	if hosts.domain != "" || hosts.domains != nil {
+		host, reader := peekHost(userConn)
+		user = tunnel.NewBufferedConn(userConn, reader)
+		name, known = hosts.tunnelFor(host)
+		if !known {
+			rejectNotFound(id, user, host)
+			return
+		}
+	}
+
+	if tunnelConn := tunnels.take(name); tunnelConn != nil {
+		handleTraffic(id, user, tunnelConn)
+		return
+	}
+
+	// Bu node'da bo'sh tunnel yo'q - cluster'dagi boshqa node'ga uzatamiz
+	if nodes != nil && nodes.forward(id, name, user) {
+		return
+	}
+
+	if tunnels.pool(name, false) == nil {
+		rejectNotFound(id, user, name)
+		return
+	}
+	rejectUnavailable(id, user)
+}
+
+func rejectNotFound(id int64, user net.Conn, name string) {
+	fmt.Printf("[Req #%d] XATO: %q tunneli topilmadi!\n", id, name)
+	monitor.Error("[Req #%d] %q tunneli topilmadi (%s)", id, name, user.RemoteAddr())
+	user.Write([]byte("HTTP/1.1 404 Not Found\r\nConnection: close\r\n\r\nTunnel topilmadi: " + name))
+	user.Close()
+}
+
+func rejectUnavailable(id int64, user net.Conn) {
+	fmt.Printf("[Req #%d] XATO: Bo'sh tunnel yo'q!\n", id)
+	monitor.Error("[Req #%d] bo'sh tunnel yo'q (%s)", id, user.RemoteAddr())
+	user.Write([]byte("HTTP/1.1 503 Service Unavailable\r\n\r\nZaxirada tunnel yo'q."))
+	user.Close()
+}
+
+func handleTraffic(id int64, user, tunnelConn net.Conn) {
+	defer user.Close()
+	defer tunnelConn.Close()
+
+	monitor.StreamOpened(id, user.RemoteAddr())
+
+	var bytesIn, bytesOut int64
+
+	// Ma'lumot hajmini hisoblash uchun wrapper
+	copyAndLog := func(dst io.Writer, src io.Reader, direction string, total *int64) {
+		n, err := io.Copy(dst, src)
+		*total = n
+		if n > 0 {
+			fmt.Printf("[Req #%d] %s: %d bytes uzatildi\n", id, direction, n)
+		}
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			monitor.Error("[Req #%d] %s: %v", id, direction, err)
+		}
+	}
+
+	done := make(chan struct{}, 2)
+
+	// Request (User -> Tunnel -> Laravel)
+	go func() {
+		copyAndLog(&trafficWriter{w: tunnelConn, in: true}, user, "REQUEST ", &bytesIn)
+		done <- struct{}{}
+	}()
+
+	// Response (Laravel -> Tunnel -> User)
+	go func() {
+		copyAndLog(&trafficWriter{w: user}, tunnelConn, "RESPONSE", &bytesOut)
+		done <- struct{}{}
+	}()
+
+	<-done
+	// Ikkinchi yo'nalish ham tugashi uchun ulanishlarni yopamiz
+	user.Close()
+	tunnelConn.Close()
+	<-done
+
+	monitor.StreamClosed(id, bytesIn, bytesOut)
+	if compressed, ok := tunnelConn.(*tunnel.CompressedConn); ok {
+		stats := compressed.Stats()
+		monitor.AddCompression(stats)
+		fmt.Printf("[Req #%d] Siqish: %d -> %d bytes (%.2fx)\n", id,
+			stats.RawIn+stats.RawOut, stats.WireIn+stats.WireOut, stats.Ratio())
+	}
+	fmt.Printf("[Req #%d] Ulanish yakunlandi.\n", id)
 }
 
+// trafficWriter - har bir yozilgan baytni monitoringga yuboradi (grafiklar uchun)
+type trafficWriter struct {
+	w  io.Writer
+	in bool
+}
 
+func (t *trafficWriter) Write(p []byte) (int, error) {
+	n, err := t.w.Write(p)
+	if t.in {
+		monitor.AddTraffic(int64(n), 0)
+	} else {
+		monitor.AddTraffic(0, int64(n))
+	}
+	return n, err
+}
@@ -1,8 +1,68 @@
 package services
 
-import "go-tunnel/utils"
+import (
+	"errors"
+	"strings"
+	"time"
 
-// GenerateAdminToken generates a secure token for admin
-func GenerateAdminToken() string {
-	return "admin_token_" + utils.GenerateRandomString(16)
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"go-tunnel/jwt"
+	"go-tunnel/models"
+)
+
+// Token errors; CheckAuth reports them to the client as invalid_token
+var (
+	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrTokenExpired = errors.New("token expired")
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+// AuthenticateToken returns the user of an access token in auth_tokens that
+// is neither expired nor revoked, and the token row itself. The token may be
+// passed with or without the "Bearer " prefix. Unknown tokens, refresh
+// tokens and tokens of deleted users are ErrInvalidToken.
+//
+// JWTs are checked by AuthenticateJWT instead; they have no row, so the
+// returned token is nil.
+func AuthenticateToken(token string) (*models.User, *models.AuthToken, error) {
+	token = strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))
+	if token == "" {
+		return nil, nil, ErrInvalidToken
+	}
+	if jwt.IsJWT(token) {
+		user, err := AuthenticateJWT(token)
+		return user, nil, err
+	}
+
+	var authToken models.AuthToken
+	result := quietDB().Where("token = ? AND kind = ?", hashToken(token), models.TokenKindAccess).Limit(1).Find(&authToken)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrInvalidToken
+	}
+	switch {
+	case authToken.RevokedAt != nil:
+		return nil, nil, ErrTokenRevoked
+	case !authToken.ExpiresAt.After(time.Now()):
+		return nil, nil, ErrTokenExpired
+	}
+
+	var user models.User
+	result = DB.Limit(1).Find(&user, authToken.UserID)
+	if result.Error != nil {
+		return nil, nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrInvalidToken
+	}
+	return &user, &authToken, nil
+}
+
+// quietDB is DB without the SQL log, for queries that have a token in them
+func quietDB() *gorm.DB {
+	return DB.Session(&gorm.Session{Logger: DB.Logger.LogMode(logger.Silent)})
 }
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"time"
+
+	"gorm.io/gorm/clause"
+
+	"go-tunnel/models"
+)
+
+// AnnounceTunnelSession records (or refreshes) that nodeID holds tunnel name
+// for the client session owner
+func AnnounceTunnelSession(name, nodeID, nodeAddr, owner string) error {
+	session := models.TunnelSession{Name: name, NodeID: nodeID, NodeAddr: nodeAddr, Owner: owner}
+	return DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}, {Name: "node_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"node_addr", "owner", "updated_at"}),
+	}).Create(&session).Error
+}
+
+// TunnelSessionOwner returns the owner of tunnel name on a node other than
+// exceptNodeID that refreshed it within maxAge, or "" if there is none
+func TunnelSessionOwner(name, exceptNodeID string, maxAge time.Duration) (string, error) {
+	var owners []string
+	err := DB.Model(&models.TunnelSession{}).
+		Where("name = ? AND node_id <> ? AND updated_at > ?", name, exceptNodeID, time.Now().Add(-maxAge)).
+		Order("created_at").
+		Limit(1).
+		Pluck("owner", &owners).Error
+	if err != nil || len(owners) == 0 {
+		return "", err
+	}
+	return owners[0], nil
+}
+
+// WithdrawTunnelSession removes nodeID's record of tunnel name
+func WithdrawTunnelSession(name, nodeID string) error {
+	return DB.Where("name = ? AND node_id = ?", name, nodeID).Delete(&models.TunnelSession{}).Error
+}
+
+// TunnelSessionNodes returns the nodes that refreshed tunnel name within maxAge
+func TunnelSessionNodes(name string, maxAge time.Duration) ([]models.TunnelSession, error) {
+	var sessions []models.TunnelSession
+	err := DB.Where("name = ? AND updated_at > ?", name, time.Now().Add(-maxAge)).
+		Order("updated_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
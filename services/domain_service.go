@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go-tunnel/models"
+)
+
+// verificationPrefix is the TXT record label checked during verification
+const verificationPrefix = "_mytunnel-challenge."
+
+var (
+	// ErrInvalidDomain is returned for malformed domain names
+	ErrInvalidDomain = errors.New("invalid domain")
+	// ErrDomainTaken is returned when another user has verified the domain
+	ErrDomainTaken = errors.New("domain is already registered")
+	// ErrDomainNotFound is returned when the user has no such custom domain
+	ErrDomainNotFound = errors.New("custom domain not found")
+	// ErrDomainNotVerified is returned when neither DNS record matches
+	ErrDomainNotVerified = errors.New("domain DNS records do not match")
+)
+
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// Resolver is the DNS lookup used for domain verification; *net.Resolver
+// satisfies it and tests can swap in a fake
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+}
+
+// DomainResolver is the resolver used by VerifyCustomDomain
+var DomainResolver Resolver = net.DefaultResolver
+
+// TunnelDomain returns the base domain of tunnels (TUNNEL_DOMAIN), e.g. tunnel.example.com
+func TunnelDomain() string {
+	return strings.ToLower(strings.Trim(os.Getenv("TUNNEL_DOMAIN"), "."))
+}
+
+// NormalizeDomain lowercases and validates a custom domain name
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.ToLower(strings.Trim(strings.TrimSpace(domain), "."))
+	if len(domain) > 253 || !domainPattern.MatchString(domain) {
+		return "", ErrInvalidDomain
+	}
+	if base := TunnelDomain(); base != "" && (domain == base || strings.HasSuffix(domain, "."+base)) {
+		return "", ErrInvalidDomain
+	}
+	return domain, nil
+}
+
+// ListCustomDomains returns the custom domains registered by a user
+func ListCustomDomains(userID uint) ([]models.CustomDomain, error) {
+	var domains []models.CustomDomain
+	err := DB.Preload("ReservedDomain").Where("user_id = ?", userID).Order("domain").Find(&domains).Error
+	return domains, err
+}
+
+// AddCustomDomain registers a custom domain for one of the user's reserved
+// tunnels. The domain stays unverified until VerifyCustomDomain succeeds;
+// until then other users may claim it too and the first to verify keeps it.
+func AddCustomDomain(userID uint, tunnelName, domain string) (*models.CustomDomain, error) {
+	domain, err := NormalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	tunnelName, err = NormalizeTunnelName(tunnelName)
+	if err != nil {
+		return nil, err
+	}
+
+	var reserved models.ReservedDomain
+	err = DB.Where("user_id = ? AND name = ?", userID, tunnelName).First(&reserved).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrTunnelNameNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var verified int64
+	err = DB.Model(&models.CustomDomain{}).
+		Where("domain = ? AND user_id <> ? AND verified_at IS NOT NULL", domain, userID).
+		Count(&verified).Error
+	if err != nil {
+		return nil, err
+	}
+	if verified > 0 {
+		return nil, ErrDomainTaken
+	}
+
+	var existing models.CustomDomain
+	err = DB.Where("user_id = ? AND domain = ?", userID, domain).First(&existing).Error
+	switch {
+	case err == nil:
+		// Re-pointing an own domain to another tunnel needs a new verification
+		if existing.ReservedDomainID != reserved.ID {
+			existing.ReservedDomainID = reserved.ID
+			existing.VerifiedAt = nil
+			if err := DB.Save(&existing).Error; err != nil {
+				return nil, err
+			}
+		}
+		existing.ReservedDomain = reserved
+		return &existing, nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	token, err := verificationToken()
+	if err != nil {
+		return nil, err
+	}
+	custom := models.CustomDomain{
+		UserID:            userID,
+		ReservedDomainID:  reserved.ID,
+		Domain:            domain,
+		VerificationToken: token,
+	}
+	if err := DB.Create(&custom).Error; err != nil {
+		if isDuplicate(err) {
+			// A parallel request of the same user created the claim first
+			err = DB.Where("user_id = ? AND domain = ?", userID, domain).First(&custom).Error
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	custom.ReservedDomain = reserved
+	return &custom, nil
+}
+
+func isDuplicate(err error) bool {
+	return strings.Contains(strings.ToLower(err.Error()), "duplicate")
+}
+
+// VerifyCustomDomain checks the domain's DNS: either a TXT record
+// _mytunnel-challenge.<domain> with the verification token, or a CNAME
+// pointing at <tunnel>.<TUNNEL_DOMAIN>. The first user to verify gets the
+// domain and the other users' pending claims are dropped.
+func VerifyCustomDomain(ctx context.Context, userID uint, domain string) (*models.CustomDomain, error) {
+	domain, err := NormalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	var custom models.CustomDomain
+	err = DB.Preload("ReservedDomain").Where("user_id = ? AND domain = ?", userID, domain).First(&custom).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDomainNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if !dnsMatches(ctx, &custom) {
+		return &custom, ErrDomainNotVerified
+	}
+
+	now := time.Now()
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&custom).Update("verified_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Where("domain = ? AND id <> ? AND verified_at IS NULL", custom.Domain, custom.ID).
+			Delete(&models.CustomDomain{}).Error
+	})
+	if err != nil {
+		// Another user verified it first (idx_custom_domains_verified_domain)
+		if isDuplicate(err) {
+			return nil, ErrDomainTaken
+		}
+		return nil, err
+	}
+	custom.VerifiedAt = &now
+	return &custom, nil
+}
+
+// VerificationInstructions describes the DNS records that verify a domain
+func VerificationInstructions(custom *models.CustomDomain) map[string]string {
+	instructions := map[string]string{
+		"txt_name":  verificationPrefix + custom.Domain,
+		"txt_value": custom.VerificationToken,
+	}
+	if base := TunnelDomain(); base != "" {
+		instructions["cname_name"] = custom.Domain
+		instructions["cname_value"] = custom.ReservedDomain.Name + "." + base
+	}
+	return instructions
+}
+
+// RemoveCustomDomain deletes a user's custom domain
+func RemoveCustomDomain(userID uint, domain string) error {
+	domain, err := NormalizeDomain(domain)
+	if err != nil {
+		return err
+	}
+
+	result := DB.Where("user_id = ? AND domain = ?", userID, domain).Delete(&models.CustomDomain{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrDomainNotFound
+	}
+	return nil
+}
+
+// TunnelForCustomDomain returns the tunnel name a verified custom domain
+// points at; ok is false for unknown or unverified domains
+func TunnelForCustomDomain(domain string) (name string, ok bool, err error) {
+	var custom models.CustomDomain
+	err = DB.Preload("ReservedDomain").
+		Where("domain = ? AND verified_at IS NOT NULL", strings.ToLower(domain)).
+		First(&custom).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return custom.ReservedDomain.Name, true, nil
+}
+
+// VerifiedCustomDomains returns every verified custom domain, so the tunnel
+// server only looks up hosts that can match one
+func VerifiedCustomDomains() ([]string, error) {
+	var domains []string
+	err := DB.Model(&models.CustomDomain{}).
+		Where("verified_at IS NOT NULL").
+		Pluck("domain", &domains).Error
+	return domains, err
+}
+
+// VerifiedDomainsForTunnel returns the verified custom domains that point at
+// the tunnel, sorted by name
+func VerifiedDomainsForTunnel(name string) ([]string, error) {
+	var domains []string
+	err := DB.Model(&models.CustomDomain{}).
+		Joins("JOIN reserved_domains ON reserved_domains.id = custom_domains.reserved_domain_id").
+		Where("reserved_domains.name = ? AND custom_domains.verified_at IS NOT NULL", name).
+		Order("custom_domains.domain").
+		Pluck("custom_domains.domain", &domains).Error
+	return domains, err
+}
+
+func dnsMatches(ctx context.Context, custom *models.CustomDomain) bool {
+	if records, err := DomainResolver.LookupTXT(ctx, verificationPrefix+custom.Domain); err == nil {
+		for _, record := range records {
+			if strings.TrimSpace(record) == custom.VerificationToken {
+				return true
+			}
+		}
+	}
+
+	if base := TunnelDomain(); base != "" {
+		target := custom.ReservedDomain.Name + "." + base
+		if cname, err := DomainResolver.LookupCNAME(ctx, custom.Domain); err == nil {
+			if strings.EqualFold(strings.TrimSuffix(cname, "."), target) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func verificationToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate verification token: %w", err)
+	}
+	return "mytunnel-verify=" + hex.EncodeToString(b), nil
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// fakeResolver answers DNS lookups from maps; missing names fail like NXDOMAIN
+type fakeResolver struct {
+	txt   map[string][]string
+	cname map[string]string
+}
+
+func (r fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if records, ok := r.txt[name]; ok {
+		return records, nil
+	}
+	return nil, fmt.Errorf("lookup %s: no such host", name)
+}
+
+func (r fakeResolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if cname, ok := r.cname[host]; ok {
+		return cname, nil
+	}
+	return "", fmt.Errorf("lookup %s: no such host", host)
+}
+
+func useResolver(t *testing.T, resolver Resolver) {
+	t.Helper()
+	previous := DomainResolver
+	DomainResolver = resolver
+	t.Cleanup(func() { DomainResolver = previous })
+}
+
+// openDomainDB seeds one reserved tunnel per user (alice -> 1, bob -> 2) and
+// enforces the unique index on verified custom domains
+func openDomainDB(t *testing.T) *fakeDB {
+	t.Helper()
+	t.Setenv("TUNNEL_DOMAIN", "tunnel.example.com")
+	db := openTestDB(t)
+	db.insert("reserved_domains", fakeRow{"user_id": int64(1), "name": "alice"})
+	db.insert("reserved_domains", fakeRow{"user_id": int64(2), "name": "bob"})
+	db.unique["custom_domains"] = func(rows []fakeRow) error {
+		verified := map[string]bool{}
+		for _, row := range rows {
+			if row["verified_at"] == nil {
+				continue
+			}
+			domain := fmt.Sprint(row["domain"])
+			if verified[domain] {
+				return errors.New(`duplicate key value violates unique constraint "idx_custom_domains_verified_domain"`)
+			}
+			verified[domain] = true
+		}
+		return nil
+	}
+	return db
+}
+
+func TestVerifyCustomDomain(t *testing.T) {
+	cases := []struct {
+		name     string
+		resolver func(token string) fakeResolver
+		want     error
+	}{
+		{"txt", func(token string) fakeResolver {
+			return fakeResolver{txt: map[string][]string{"_mytunnel-challenge.dev.customer.com": {"other", " " + token + " "}}}
+		}, nil},
+		{"cname", func(string) fakeResolver {
+			return fakeResolver{cname: map[string]string{"dev.customer.com": "Alice.tunnel.example.com."}}
+		}, nil},
+		{"wrong txt", func(string) fakeResolver {
+			return fakeResolver{txt: map[string][]string{"_mytunnel-challenge.dev.customer.com": {"mytunnel-verify=stale"}}}
+		}, ErrDomainNotVerified},
+		{"cname to another tunnel", func(string) fakeResolver {
+			return fakeResolver{cname: map[string]string{"dev.customer.com": "bob.tunnel.example.com"}}
+		}, ErrDomainNotVerified},
+		{"no records", func(string) fakeResolver { return fakeResolver{} }, ErrDomainNotVerified},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			openDomainDB(t)
+			custom, err := AddCustomDomain(1, "alice", "Dev.Customer.com.")
+			if err != nil {
+				t.Fatalf("AddCustomDomain: %v", err)
+			}
+			useResolver(t, c.resolver(custom.VerificationToken))
+
+			custom, err = VerifyCustomDomain(context.Background(), 1, "dev.customer.com")
+			if !errors.Is(err, c.want) {
+				t.Fatalf("VerifyCustomDomain error = %v, want %v", err, c.want)
+			}
+
+			name, ok, err := TunnelForCustomDomain("dev.customer.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if verified := c.want == nil; ok != verified || (verified && name != "alice") {
+				t.Errorf("TunnelForCustomDomain = %q, %v; want verified=%v", name, ok, verified)
+			}
+			if c.want == nil && custom.VerifiedAt == nil {
+				t.Error("VerifiedAt is not set after verification")
+			}
+		})
+	}
+}
+
+func TestFirstVerificationWins(t *testing.T) {
+	db := openDomainDB(t)
+
+	alice, err := AddCustomDomain(1, "alice", "dev.customer.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := AddCustomDomain(2, "bob", "dev.customer.com")
+	if err != nil {
+		t.Fatalf("a pending claim must not block other users: %v", err)
+	}
+	if alice.VerificationToken == bob.VerificationToken {
+		t.Fatal("claims share a verification token")
+	}
+
+	// Only bob controls the DNS
+	useResolver(t, fakeResolver{txt: map[string][]string{
+		"_mytunnel-challenge.dev.customer.com": {bob.VerificationToken},
+	}})
+
+	if _, err := VerifyCustomDomain(context.Background(), 2, "dev.customer.com"); err != nil {
+		t.Fatalf("bob: %v", err)
+	}
+	if rows := db.rows("custom_domains", fakeRow{"domain": "dev.customer.com"}); len(rows) != 1 || fmt.Sprint(rows[0]["user_id"]) != "2" {
+		t.Fatalf("pending claims were not dropped: %v", rows)
+	}
+
+	if _, err := VerifyCustomDomain(context.Background(), 1, "dev.customer.com"); !errors.Is(err, ErrDomainNotFound) {
+		t.Errorf("alice verify after bob = %v, want %v", err, ErrDomainNotFound)
+	}
+	if _, err := AddCustomDomain(1, "alice", "dev.customer.com"); !errors.Is(err, ErrDomainTaken) {
+		t.Errorf("alice re-add after bob = %v, want %v", err, ErrDomainTaken)
+	}
+
+	name, ok, err := TunnelForCustomDomain("dev.customer.com")
+	if err != nil || !ok || name != "bob" {
+		t.Errorf("TunnelForCustomDomain = %q, %v, %v; want bob", name, ok, err)
+	}
+}
+
+// TestVerifyRace covers two users verifying at the same time: the second
+// update hits the unique index and reports the domain as taken
+func TestVerifyRace(t *testing.T) {
+	db := openDomainDB(t)
+
+	if _, err := AddCustomDomain(1, "alice", "dev.customer.com"); err != nil {
+		t.Fatal(err)
+	}
+	bob, err := AddCustomDomain(2, "bob", "dev.customer.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	useResolver(t, fakeResolver{cname: map[string]string{"dev.customer.com": "alice.tunnel.example.com"}})
+
+	// Bob's claim got verified by another request between alice's lookup and update
+	for _, row := range db.tables["custom_domains"] {
+		if fmt.Sprint(row["id"]) == fmt.Sprint(bob.ID) {
+			row["verified_at"] = row["created_at"]
+		}
+	}
+	if _, err := VerifyCustomDomain(context.Background(), 1, "dev.customer.com"); !errors.Is(err, ErrDomainTaken) {
+		t.Errorf("VerifyCustomDomain = %v, want %v", err, ErrDomainTaken)
+	}
+}
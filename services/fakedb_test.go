@@ -0,0 +1,314 @@
+package services
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeDB is an in-memory database/sql driver that understands just the
+// statements gorm generates for the services under test: single-table
+// SELECT / SELECT count(*) / INSERT ... RETURNING / UPDATE / DELETE with
+// WHERE clauses of "col = ?", "col <> ?", "col > ?" and "col IS [NOT] NULL"
+// joined by AND. It lets the services be tested without a database server.
+type fakeDB struct {
+	mu     sync.Mutex
+	tables map[string][]fakeRow
+	nextID map[string]int64
+	// unique checks a table after every write, like a unique index would
+	unique map[string]func(rows []fakeRow) error
+}
+
+type fakeRow map[string]driver.Value
+
+var (
+	fakeOnce    sync.Once
+	fakeCurrent *fakeDB
+)
+
+// openTestDB points DB at a fresh fake database for the test
+func openTestDB(t *testing.T) *fakeDB {
+	t.Helper()
+	fakeOnce.Do(func() { sql.Register("fakedb", fakeDriver{}) })
+
+	db := &fakeDB{tables: map[string][]fakeRow{}, nextID: map[string]int64{}, unique: map[string]func([]fakeRow) error{}}
+	fakeCurrent = db
+	sqlDB, err := sql.Open("fakedb", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB, PreferSimpleProtocol: true}),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	previous := DB
+	DB = gormDB
+	t.Cleanup(func() {
+		DB = previous
+		sqlDB.Close()
+	})
+	return db
+}
+
+// insert adds a row directly and returns its id
+func (db *fakeDB) insert(table string, row fakeRow) int64 {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.nextID[table]++
+	row["id"] = db.nextID[table]
+	db.tables[table] = append(db.tables[table], row)
+	return db.nextID[table]
+}
+
+// rows returns a copy of a table's rows matching all of the column values
+func (db *fakeDB) rows(table string, where fakeRow) []fakeRow {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var out []fakeRow
+	for _, row := range db.tables[table] {
+		match := true
+		for column, value := range where {
+			if !fakeEqual(row[column], value) {
+				match = false
+			}
+		}
+		if match {
+			copied := fakeRow{}
+			for column, value := range row {
+				copied[column] = value
+			}
+			out = append(out, copied)
+		}
+	}
+	return out
+}
+
+type fakeDriver struct{}
+type fakeConn struct{}
+type fakeTx struct{}
+type fakeStmt struct{ query string }
+type fakeResult struct{ id, affected int64 }
+
+type fakeRows struct {
+	columns []string
+	values  [][]driver.Value
+	next    int
+}
+
+func (fakeDriver) Open(string) (driver.Conn, error)        { return fakeConn{}, nil }
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return fakeStmt{query}, nil }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return fakeTx{}, nil }
+func (fakeTx) Commit() error                               { return nil }
+func (fakeTx) Rollback() error                             { return nil }
+func (fakeStmt) Close() error                              { return nil }
+func (fakeStmt) NumInput() int                             { return -1 }
+func (r fakeResult) LastInsertId() (int64, error)          { return r.id, nil }
+func (r fakeResult) RowsAffected() (int64, error)          { return r.affected, nil }
+func (r *fakeRows) Columns() []string                      { return r.columns }
+func (r *fakeRows) Close() error                           { return nil }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return fakeCurrent.exec(s.query, args)
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return fakeCurrent.query(s.query, args)
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
+
+var (
+	fakeTableRe  = regexp.MustCompile(`(?:FROM|INTO|UPDATE) "(\w+)"`)
+	fakeCondRe   = regexp.MustCompile(`"?(\w+)"?\s*(<>|=|>|IS NOT NULL|IS NULL)\s*(\$\d+)?`)
+	fakeInsertRe = regexp.MustCompile(`INSERT INTO "\w+" \(([^)]*)\)`)
+	fakeSetRe    = regexp.MustCompile(`SET (.*?) WHERE`)
+	fakeLimitRe  = regexp.MustCompile(`LIMIT \$(\d+)`)
+	fakePluckRe  = regexp.MustCompile(`^SELECT "?(\w+)"? FROM`)
+)
+
+func fakeArg(args []driver.Value, placeholder string) driver.Value {
+	var i int
+	fmt.Sscanf(placeholder, "$%d", &i)
+	return args[i-1]
+}
+
+func fakeEqual(a, b driver.Value) bool {
+	if t, ok := a.(time.Time); ok {
+		u, ok := b.(time.Time)
+		return ok && t.Equal(u)
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+func fakeMatches(query string, row fakeRow, args []driver.Value) bool {
+	i := strings.Index(query, "WHERE")
+	if i < 0 {
+		return true
+	}
+	where := query[i+len("WHERE"):]
+	for _, end := range []string{"ORDER BY", "LIMIT", "RETURNING"} {
+		if j := strings.Index(where, end); j >= 0 {
+			where = where[:j]
+		}
+	}
+	for _, part := range strings.Split(where, " AND ") {
+		m := fakeCondRe.FindStringSubmatch(strings.Trim(strings.TrimSpace(part), "()"))
+		if m == nil {
+			continue
+		}
+		value := row[m[1]]
+		switch m[2] {
+		case "IS NULL":
+			if value != nil {
+				return false
+			}
+		case "IS NOT NULL":
+			if value == nil {
+				return false
+			}
+		case "=":
+			if !fakeEqual(value, fakeArg(args, m[3])) {
+				return false
+			}
+		case "<>":
+			if fakeEqual(value, fakeArg(args, m[3])) {
+				return false
+			}
+		case ">":
+			t, ok := value.(time.Time)
+			if !ok || !t.After(fakeArg(args, m[3]).(time.Time)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (db *fakeDB) query(query string, args []driver.Value) (driver.Rows, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table := fakeTableRe.FindStringSubmatch(query)[1]
+	if strings.HasPrefix(query, "INSERT") {
+		result, err := db.insertStmt(table, query, args)
+		if err != nil {
+			return nil, err
+		}
+		return &fakeRows{columns: []string{"id"}, values: [][]driver.Value{{result.id}}}, nil
+	}
+
+	var matched []fakeRow
+	for _, row := range db.tables[table] {
+		if fakeMatches(query, row, args) {
+			matched = append(matched, row)
+		}
+	}
+	if strings.HasPrefix(query, "SELECT count(*)") {
+		return &fakeRows{columns: []string{"count"}, values: [][]driver.Value{{int64(len(matched))}}}, nil
+	}
+	if m := fakeLimitRe.FindStringSubmatch(query); m != nil {
+		if limit := int(fakeArg(args, "$"+m[1]).(int64)); len(matched) > limit {
+			matched = matched[:limit]
+		}
+	}
+
+	var rows fakeRows
+	if m := fakePluckRe.FindStringSubmatch(query); m != nil && m[1] != "*" {
+		rows.columns = []string{m[1]}
+	}
+	for _, row := range matched {
+		if rows.columns == nil {
+			for column := range row {
+				rows.columns = append(rows.columns, column)
+			}
+		}
+		values := make([]driver.Value, len(rows.columns))
+		for i, column := range rows.columns {
+			values[i] = row[column]
+		}
+		rows.values = append(rows.values, values)
+	}
+	if rows.columns == nil {
+		rows.columns = []string{"id"}
+	}
+	return &rows, nil
+}
+
+func (db *fakeDB) exec(query string, args []driver.Value) (driver.Result, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	table := fakeTableRe.FindStringSubmatch(query)[1]
+	switch {
+	case strings.HasPrefix(query, "INSERT"):
+		return db.insertStmt(table, query, args)
+
+	case strings.HasPrefix(query, "DELETE"):
+		var kept []fakeRow
+		var affected int64
+		for _, row := range db.tables[table] {
+			if fakeMatches(query, row, args) {
+				affected++
+				continue
+			}
+			kept = append(kept, row)
+		}
+		db.tables[table] = kept
+		return fakeResult{affected: affected}, nil
+
+	case strings.HasPrefix(query, "UPDATE"):
+		sets := strings.Split(fakeSetRe.FindStringSubmatch(query)[1], ",")
+		var affected int64
+		for _, row := range db.tables[table] {
+			if !fakeMatches(query, row, args) {
+				continue
+			}
+			for _, set := range sets {
+				column, placeholder, _ := strings.Cut(set, "=")
+				row[strings.Trim(strings.TrimSpace(column), `"`)] = fakeArg(args, strings.TrimSpace(placeholder))
+			}
+			affected++
+		}
+		if check := db.unique[table]; check != nil {
+			if err := check(db.tables[table]); err != nil {
+				return nil, err
+			}
+		}
+		return fakeResult{affected: affected}, nil
+	}
+	return nil, fmt.Errorf("fakedb: unsupported statement %s", query)
+}
+
+func (db *fakeDB) insertStmt(table, query string, args []driver.Value) (fakeResult, error) {
+	row := fakeRow{}
+	for i, column := range strings.Split(fakeInsertRe.FindStringSubmatch(query)[1], ",") {
+		row[strings.Trim(strings.TrimSpace(column), `"`)] = args[i]
+	}
+	if check := db.unique[table]; check != nil {
+		if err := check(append(db.tables[table][:len(db.tables[table]):len(db.tables[table])], row)); err != nil {
+			return fakeResult{}, err
+		}
+	}
+	db.nextID[table]++
+	row["id"] = db.nextID[table]
+	db.tables[table] = append(db.tables[table], row)
+	return fakeResult{id: db.nextID[table], affected: 1}, nil
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-tunnel/jwt"
+	"go-tunnel/models"
+)
+
+// jwtLeeway is the clock skew tolerated between the API and edge nodes
+const jwtLeeway = 30 * time.Second
+
+// JWT settings, set by InitJWT; a nil jwtVerifier means JWTs are rejected
+var (
+	jwtKeys     *jwt.KeySet
+	jwtVerifier *jwt.Verifier
+	jwtIssuer   string
+	jwtAudience string
+)
+
+// InitJWT reads the JWT settings from the environment (after .env is loaded):
+//
+//	JWT_KEYS         kid:alg:base64 list, see jwt.ParseKeys
+//	JWT_SIGNING_KID  the key that signs new tokens (default: the first one)
+//	JWT_JWKS_URL     the API's /.well-known/jwks.json, for edge nodes that
+//	                 verify EdDSA tokens without holding the private key
+//	JWT_ISSUER       "iss" written into and required from tokens
+//	JWT_AUDIENCE     "aud" written into and required from tokens
+//
+// With neither JWT_KEYS nor JWT_JWKS_URL set JWTs stay disabled.
+func InitJWT() error {
+	keys, err := jwt.ParseKeys(os.Getenv("JWT_KEYS"))
+	if err != nil {
+		return err
+	}
+	set, err := jwt.NewKeySet(keys, os.Getenv("JWT_SIGNING_KID"))
+	if err != nil {
+		return err
+	}
+	jwtKeys = set
+	jwtIssuer = os.Getenv("JWT_ISSUER")
+	jwtAudience = os.Getenv("JWT_AUDIENCE")
+
+	var finder jwt.KeyFinder = set
+	jwksURL := os.Getenv("JWT_JWKS_URL")
+	if jwksURL != "" {
+		finder = jwt.KeyFinders{set, jwt.NewRemoteKeySet(jwksURL)}
+	}
+	jwtVerifier = nil
+	if len(keys) > 0 || jwksURL != "" {
+		jwtVerifier = &jwt.Verifier{Keys: finder, Issuer: jwtIssuer, Audience: jwtAudience, Leeway: jwtLeeway}
+	}
+	return nil
+}
+
+// JWKS is the public key set served at /.well-known/jwks.json
+func JWKS() jwt.JWKS {
+	if jwtKeys == nil {
+		return jwt.JWKS{Keys: []jwt.JWK{}}
+	}
+	return jwtKeys.JWKS()
+}
+
+// JWTEnabled reports whether InitJWT configured keys to verify JWTs with
+func JWTEnabled() bool {
+	return jwtVerifier != nil
+}
+
+// IssueJWT signs a stateless access token for the user that is valid until
+// expiresAt. The user's reserved tunnel names go into the "tunnels" claim;
+// names reserved later show up in the next token. It returns "" when this
+// node has no signing key.
+func IssueJWT(userID uint, expiresAt time.Time) (string, error) {
+	if jwtKeys == nil {
+		return "", nil
+	}
+	key, ok := jwtKeys.SigningKey()
+	if !ok {
+		return "", nil
+	}
+	id, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+	reserved, err := ListReservedDomains(userID)
+	if err != nil {
+		return "", err
+	}
+	claims := jwt.Claims{
+		Issuer:    jwtIssuer,
+		Subject:   strconv.FormatUint(uint64(userID), 10),
+		ExpiresAt: expiresAt.Unix(),
+		IssuedAt:  time.Now().Unix(),
+		ID:        id,
+	}
+	for _, domain := range reserved {
+		claims.Tunnels = append(claims.Tunnels, domain.Name)
+	}
+	if jwtAudience != "" {
+		claims.Audience = jwt.Audience{jwtAudience}
+	}
+	return jwt.Sign(claims, key)
+}
+
+// AuthenticateJWT verifies a JWT without touching the database and returns
+// its user, which only has ID set (from "sub"). Such a token stays valid
+// until it expires, even after logout, so its lifetime should be short.
+func AuthenticateJWT(token string) (*models.User, error) {
+	claims, err := verifyJWT(token)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil || id == 0 {
+		return nil, fmt.Errorf("%w: bad sub %q", ErrInvalidToken, claims.Subject)
+	}
+	return &models.User{ID: uint(id)}, nil
+}
+
+// AuthorizeTunnelNameJWT is AuthorizeTunnelName for tunnel servers without a
+// database: they can't tell which names are reserved, so every named tunnel
+// needs a JWT whose "tunnels" claim lists the name. Anonymous tunnels
+// (empty name) are always allowed.
+func AuthorizeTunnelNameJWT(name, token string) error {
+	if name == "" {
+		return nil
+	}
+	name, err := NormalizeTunnelName(name)
+	if err != nil {
+		return err
+	}
+	token = strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))
+	if !jwt.IsJWT(token) {
+		return fmt.Errorf("%q needs a JWT listing it: %w", name, ErrInvalidToken)
+	}
+	claims, err := verifyJWT(token)
+	if err != nil {
+		return fmt.Errorf("%q: %w", name, err)
+	}
+	for _, tunnel := range claims.Tunnels {
+		if tunnel == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("%q is not reserved by the token's user", name)
+}
+
+// verifyJWT checks a JWT and maps its errors to the token errors
+func verifyJWT(token string) (*jwt.Claims, error) {
+	if jwtVerifier == nil {
+		return nil, fmt.Errorf("%w: JWTs are disabled", ErrInvalidToken)
+	}
+	claims, err := jwtVerifier.Verify(token)
+	switch {
+	case errors.Is(err, jwt.ErrExpired):
+		return nil, ErrTokenExpired
+	case isJWTError(err):
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	case err != nil:
+		// The JWKS could not be fetched
+		return nil, err
+	}
+	return claims, nil
+}
+
+// isJWTError reports whether err means the token itself is bad
+func isJWTError(err error) bool {
+	for _, target := range []error{jwt.ErrMalformed, jwt.ErrUnsupportedAlg, jwt.ErrUnknownKey,
+		jwt.ErrSignature, jwt.ErrNotYetValid, jwt.ErrIssuer, jwt.ErrAudience} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+
+	"go-tunnel/models"
+)
+
+// ErrTokenReused is returned when a refresh token is presented a second
+// time; the whole token family has been revoked by then
+var ErrTokenReused = errors.New("refresh token reused")
+
+const (
+	// defaultAccessTTL is how long access tokens live unless AUTH_TOKEN_TTL
+	// (a Go duration like 30m) says otherwise
+	defaultAccessTTL = time.Hour
+	// defaultRefreshTTL is how long refresh tokens live unless
+	// AUTH_REFRESH_TTL says otherwise
+	defaultRefreshTTL = 30 * 24 * time.Hour
+)
+
+// TokenPair is what a login or refresh hands out
+type TokenPair struct {
+	Access  *models.AuthToken
+	Refresh *models.AuthToken
+}
+
+// IssueTokenPair starts a new session (token family) for the user
+func IssueTokenPair(userID uint) (*TokenPair, error) {
+	family, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	var pair *TokenPair
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		pair, err = issuePair(tx, userID, family)
+		return err
+	})
+	return pair, err
+}
+
+// RefreshTokens rotates a refresh token: it is marked used, the family's
+// older access tokens are revoked and a new pair in the same family is
+// returned. Presenting a used refresh token again means it leaked, so the
+// whole family is revoked and ErrTokenReused returned.
+func RefreshTokens(refreshToken string) (*TokenPair, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidToken
+	}
+
+	quiet := quietDB()
+	var token models.AuthToken
+	result := quiet.Where("token = ? AND kind = ?", hashToken(refreshToken), models.TokenKindRefresh).Limit(1).Find(&token)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidToken
+	}
+
+	switch {
+	case token.UsedAt != nil:
+		if err := revokeFamily(DB, token); err != nil {
+			return nil, err
+		}
+		return nil, ErrTokenReused
+	case token.RevokedAt != nil:
+		return nil, ErrTokenRevoked
+	case !token.ExpiresAt.After(time.Now()):
+		return nil, ErrTokenExpired
+	}
+
+	var pair *TokenPair
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		// Only one of two parallel refreshes with the same token wins
+		used := tx.Model(&models.AuthToken{}).
+			Where("id = ? AND used_at IS NULL", token.ID).
+			Updates(map[string]interface{}{"used_at": now, "revoked_at": now})
+		if used.Error != nil {
+			return used.Error
+		}
+		if used.RowsAffected == 0 {
+			return ErrTokenReused
+		}
+		if err := revokeFamily(tx, token); err != nil {
+			return err
+		}
+
+		family := ""
+		if token.FamilyID != nil {
+			family = *token.FamilyID
+		}
+		var err error
+		pair, err = issuePair(tx, token.UserID, family)
+		return err
+	})
+	if errors.Is(err, ErrTokenReused) {
+		if err := revokeFamily(DB, token); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// RevokeSession logs out the session of an access token: the token and the
+// rest of its family, so its refresh token stops working too
+func RevokeSession(token *models.AuthToken) error {
+	return revokeFamily(DB, *token)
+}
+
+// RevokeAllSessions logs the user out everywhere
+func RevokeAllSessions(userID uint) error {
+	return DB.Model(&models.AuthToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeFamily revokes every live token of token's family, or just token
+// itself if it predates families
+func revokeFamily(tx *gorm.DB, token models.AuthToken) error {
+	query := tx.Model(&models.AuthToken{}).Where("revoked_at IS NULL")
+	if token.FamilyID != nil {
+		query = query.Where("family_id = ?", *token.FamilyID)
+	} else {
+		query = query.Where("id = ?", token.ID)
+	}
+	return query.Update("revoked_at", time.Now()).Error
+}
+
+func issuePair(tx *gorm.DB, userID uint, family string) (*TokenPair, error) {
+	access, err := issueToken(tx, userID, models.TokenKindAccess, family, envTTL("AUTH_TOKEN_TTL", defaultAccessTTL))
+	if err != nil {
+		return nil, err
+	}
+	refresh, err := issueToken(tx, userID, models.TokenKindRefresh, family, envTTL("AUTH_REFRESH_TTL", defaultRefreshTTL))
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{Access: access, Refresh: refresh}, nil
+}
+
+// issueToken stores a new random auth_tokens row; the returned Value is what
+// the client sends as "Authorization: Bearer <token>"
+func issueToken(tx *gorm.DB, userID uint, kind, family string, ttl time.Duration) (*models.AuthToken, error) {
+	value, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	token := models.AuthToken{
+		UserID:    userID,
+		Token:     hashToken(value),
+		Value:     value,
+		Kind:      kind,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if family != "" {
+		token.FamilyID = &family
+	}
+	if err := tx.Create(&token).Error; err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+// hashToken is what auth_tokens.token holds for a token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func envTTL(name string, fallback time.Duration) time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv(name)); err == nil && ttl > 0 {
+		return ttl
+	}
+	return fallback
+}
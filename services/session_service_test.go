@@ -0,0 +1,153 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+// openSessionDB seeds user 1 for the token tests
+func openSessionDB(t *testing.T) *fakeDB {
+	t.Helper()
+	db := openTestDB(t)
+	db.insert("users", fakeRow{"name": "Alice", "email": "alice@example.com", "password": "x"})
+	return db
+}
+
+func TestRefreshTokensRotates(t *testing.T) {
+	db := openSessionDB(t)
+
+	first, err := IssueTokenPair(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rows := db.rows("auth_tokens", fakeRow{"token": first.Access.Value}); len(rows) != 0 {
+		t.Fatal("token stored in plain text")
+	}
+	if user, _, err := AuthenticateToken("Bearer " + first.Access.Value); err != nil || user.ID != 1 {
+		t.Fatalf("AuthenticateToken(access) = %v, %v", user, err)
+	}
+	if _, _, err := AuthenticateToken(first.Refresh.Value); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("a refresh token must not authenticate requests: %v", err)
+	}
+
+	second, err := RefreshTokens(first.Refresh.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *second.Access.FamilyID != *first.Access.FamilyID || *second.Refresh.FamilyID != *first.Access.FamilyID {
+		t.Error("refreshed pair left the family")
+	}
+	if second.Refresh.Value == first.Refresh.Value || second.Access.Value == first.Access.Value {
+		t.Error("refresh returned the old tokens")
+	}
+
+	cases := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"old access", first.Access.Value, ErrTokenRevoked},
+		{"new access", second.Access.Value, nil},
+		{"unknown", "not-a-token", ErrInvalidToken},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if _, _, err := AuthenticateToken(c.token); !errors.Is(err, c.want) {
+				t.Errorf("AuthenticateToken = %v, want %v", err, c.want)
+			}
+		})
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	openSessionDB(t)
+
+	first, err := IssueTokenPair(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := IssueTokenPair(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := RefreshTokens(first.Refresh.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The old refresh token shows up again: it leaked
+	if _, err := RefreshTokens(first.Refresh.Value); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("replayed refresh = %v, want %v", err, ErrTokenReused)
+	}
+
+	cases := []struct {
+		name    string
+		refresh bool
+		token   string
+		want    error
+	}{
+		{"rotated access", false, second.Access.Value, ErrTokenRevoked},
+		{"rotated refresh", true, second.Refresh.Value, ErrTokenRevoked},
+		{"other session access", false, other.Access.Value, nil},
+		{"other session refresh", true, other.Refresh.Value, nil},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if c.refresh {
+				_, err = RefreshTokens(c.token)
+			} else {
+				_, _, err = AuthenticateToken(c.token)
+			}
+			if !errors.Is(err, c.want) {
+				t.Errorf("error = %v, want %v", err, c.want)
+			}
+		})
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	openSessionDB(t)
+
+	pair, err := IssueTokenPair(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := IssueTokenPair(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, token, err := AuthenticateToken(pair.Access.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeSession(token); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RefreshTokens(pair.Refresh.Value); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("refresh after logout = %v, want %v", err, ErrTokenRevoked)
+	}
+	if _, _, err := AuthenticateToken(other.Access.Value); err != nil {
+		t.Errorf("logout revoked another session: %v", err)
+	}
+
+	if err := RevokeAllSessions(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := AuthenticateToken(other.Access.Value); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("after RevokeAllSessions = %v, want %v", err, ErrTokenRevoked)
+	}
+}
+
+func TestRefreshTokenExpired(t *testing.T) {
+	openSessionDB(t)
+	t.Setenv("AUTH_REFRESH_TTL", "1ns")
+
+	pair, err := IssueTokenPair(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RefreshTokens(pair.Refresh.Value); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("expired refresh = %v, want %v", err, ErrTokenExpired)
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"go-tunnel/tunnel"
+)
+
+// TunnelAdminURL returns the tunnel server monitoring address (TUNNEL_ADMIN_URL)
+func TunnelAdminURL() string {
+	url := os.Getenv("TUNNEL_ADMIN_URL")
+	if url == "" {
+		url = "http://127.0.0.1:9100"
+	}
+	return strings.TrimRight(url, "/")
+}
+
+// FetchTunnelStats gets the current state snapshot from the tunnel server
+func FetchTunnelStats(ctx context.Context) (*tunnel.Stats, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, TunnelAdminURL()+"/stats", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("tunnel server returned %s", resp.Status)
+	}
+
+	var stats tunnel.Stats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// OpenTunnelEvents opens the tunnel server event stream (text/event-stream).
+// The caller must close the returned body; it ends when ctx is cancelled.
+func OpenTunnelEvents(ctx context.Context) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, TunnelAdminURL()+"/events", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("tunnel server returned %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// CountUsers returns the number of rows in the users table
+func CountUsers() (int64, error) {
+	if DB == nil {
+		return 0, fmt.Errorf("database is not connected")
+	}
+	var count int64
+	err := DB.Table("users").Count(&count).Error
+	return count, err
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"go-tunnel/models"
+)
+
+var (
+	// ErrInvalidTunnelName is returned for names that are not valid DNS labels
+	ErrInvalidTunnelName = errors.New("invalid tunnel name")
+	// ErrTunnelNameTaken is returned when the name is reserved by another user
+	ErrTunnelNameTaken = errors.New("tunnel name is already reserved")
+	// ErrTunnelNameNotFound is returned when the user does not own the name
+	ErrTunnelNameNotFound = errors.New("tunnel name is not reserved")
+)
+
+var tunnelNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{1,61}[a-z0-9])?$`)
+
+// systemTunnelNames can never be reserved by users
+var systemTunnelNames = map[string]bool{
+	"www": true, "api": true, "admin": true, "mail": true, "tunnel": true,
+}
+
+// NormalizeTunnelName lowercases and validates a tunnel name
+func NormalizeTunnelName(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !tunnelNamePattern.MatchString(name) || len(name) < 3 || systemTunnelNames[name] {
+		return "", ErrInvalidTunnelName
+	}
+	return name, nil
+}
+
+// ListReservedDomains returns the tunnel names reserved by a user
+func ListReservedDomains(userID uint) ([]models.ReservedDomain, error) {
+	var domains []models.ReservedDomain
+	err := DB.Where("user_id = ?", userID).Order("name").Find(&domains).Error
+	return domains, err
+}
+
+// ReserveDomain reserves a tunnel name for a user. Reserving a name the user
+// already owns is not an error.
+func ReserveDomain(userID uint, name string) (*models.ReservedDomain, error) {
+	name, err := NormalizeTunnelName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing models.ReservedDomain
+	err = DB.Where("name = ?", name).First(&existing).Error
+	switch {
+	case err == nil && existing.UserID == userID:
+		return &existing, nil
+	case err == nil:
+		return nil, ErrTunnelNameTaken
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	}
+
+	domain := models.ReservedDomain{UserID: userID, Name: name}
+	if err := DB.Create(&domain).Error; err != nil {
+		// Parallel reservation of the same name hits the UNIQUE constraint
+		if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(strings.ToLower(err.Error()), "duplicate") {
+			return nil, ErrTunnelNameTaken
+		}
+		return nil, err
+	}
+	return &domain, nil
+}
+
+// ReleaseDomain removes a user's reservation of a tunnel name
+func ReleaseDomain(userID uint, name string) error {
+	name, err := NormalizeTunnelName(name)
+	if err != nil {
+		return err
+	}
+
+	result := DB.Where("user_id = ? AND name = ?", userID, name).Delete(&models.ReservedDomain{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTunnelNameNotFound
+	}
+	return nil
+}
+
+// ReservedDomainOwner returns the owner of a reserved tunnel name;
+// ok is false when nobody reserved it
+func ReservedDomainOwner(name string) (userID uint, ok bool, err error) {
+	var domain models.ReservedDomain
+	err = DB.Where("name = ?", strings.ToLower(name)).First(&domain).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return domain.UserID, true, nil
+}
+
+// AuthorizeTunnelName checks that the token may register a tunnel under name:
+// unreserved names are free to use, reserved names need the owner's token
+func AuthorizeTunnelName(name, token string) error {
+	if name == "" {
+		return nil
+	}
+	if _, err := NormalizeTunnelName(name); err != nil {
+		return err
+	}
+
+	ownerID, reserved, err := ReservedDomainOwner(name)
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		return nil
+	}
+
+	user, _, err := AuthenticateToken(token)
+	if err != nil {
+		return fmt.Errorf("%q is reserved: %w", name, err)
+	}
+	if user.ID != ownerID {
+		return fmt.Errorf("%q is reserved by another user", name)
+	}
+	return nil
+}
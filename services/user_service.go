@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"net/mail"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"go-tunnel/models"
+)
+
+var (
+	// ErrInvalidEmail is returned for addresses net/mail can't parse
+	ErrInvalidEmail = errors.New("invalid email")
+	// ErrWeakPassword is returned for passwords shorter than MinPasswordLength
+	ErrWeakPassword = errors.New("password too short")
+	// ErrPasswordTooLong is returned for passwords bcrypt would truncate
+	ErrPasswordTooLong = errors.New("password too long")
+	// ErrEmailTaken is returned when the email is already registered
+	ErrEmailTaken = errors.New("email is already registered")
+	// ErrInvalidCredentials is returned for an unknown email or a wrong
+	// password; the two are not told apart
+	ErrInvalidCredentials = errors.New("invalid email or password")
+)
+
+const (
+	// MinPasswordLength is the shortest password Register accepts
+	MinPasswordLength = 8
+	// maxPasswordLength is bcrypt's input limit in bytes
+	maxPasswordLength = 72
+)
+
+// dummyHash is compared against when the email is unknown, so a login takes
+// as long whether or not the account exists
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+// NormalizeEmail validates an address and lowercases it, so Ali@Example.com
+// and ali@example.com are the same account
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// RegisterUser creates a user with a bcrypt-hashed password. An empty name
+// defaults to the part of the email before "@".
+func RegisterUser(name, email, password string) (*models.User, error) {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(password) < MinPasswordLength:
+		return nil, ErrWeakPassword
+	case len(password) > maxPasswordLength:
+		return nil, ErrPasswordTooLong
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+
+	var count int64
+	if err := DB.Model(&models.User{}).Where("email = ?", email).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrEmailTaken
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	user := models.User{Name: name, Email: email, Password: string(hash)}
+	if err := DB.Create(&user).Error; err != nil {
+		// Parallel registration of the same email hits the UNIQUE constraint
+		if errors.Is(err, gorm.ErrDuplicatedKey) || strings.Contains(strings.ToLower(err.Error()), "duplicate") {
+			return nil, ErrEmailTaken
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Login checks an email and password against the users table
+func Login(email, password string) (*models.User, error) {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	var user models.User
+	result := DB.Where("email = ?", email).Limit(1).Find(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &user, nil
+}
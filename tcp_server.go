@@ -212,7 +212,7 @@ func startTCPServer() {
 	fmt.Println(strings.Repeat("=", 70))
 	fmt.Println("\n📡 Port: 9000")
 	fmt.Println("🔌 Address: 127.0.0.1:9000")
-	fmt.Println("\n⏳ Client lari kutilmoqda...\n")
+	fmt.Print("\n⏳ Client lari kutilmoqda...\n\n")
 	fmt.Println(strings.Repeat("=", 70) + "\n")
 	
 	clientID := 0
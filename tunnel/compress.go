@@ -0,0 +1,239 @@
+package tunnel
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// CompressionDeflate is the only compression currently negotiated in Hello
+const CompressionDeflate = "deflate"
+
+const (
+	frameRaw     byte = 0
+	frameDeflate byte = 1
+
+	frameHeaderSize = 5
+	maxFrameSize    = 64 * 1024
+	// minCompressSize - smaller writes are not worth a deflate stream
+	minCompressSize = 512
+	// maxMisses - after this many incompressible frames in a row the
+	// stream stops trying (already compressed data)...
+	maxMisses = 4
+	// retryInterval - ...except for every retryInterval-th frame, so a
+	// stream that becomes compressible again is compressed again
+	retryInterval = 64
+)
+
+// ErrFrameTooLarge is returned when a peer sends an oversized frame
+var ErrFrameTooLarge = errors.New("tunnel frame too large")
+
+// NegotiateCompression picks the first algorithm offered by the client that
+// the server supports; empty means no compression
+func NegotiateCompression(offered []string, enabled bool) string {
+	if !enabled {
+		return ""
+	}
+	for _, algorithm := range offered {
+		if algorithm == CompressionDeflate {
+			return algorithm
+		}
+	}
+	return ""
+}
+
+// CompressionStats counts payload bytes before and after compression
+type CompressionStats struct {
+	RawIn   int64 `json:"raw_in"`
+	WireIn  int64 `json:"wire_in"`
+	RawOut  int64 `json:"raw_out"`
+	WireOut int64 `json:"wire_out"`
+}
+
+// Ratio is raw bytes per wire byte in both directions (1 = no gain)
+func (s CompressionStats) Ratio() float64 {
+	wire := s.WireIn + s.WireOut
+	if wire == 0 {
+		return 1
+	}
+	return float64(s.RawIn+s.RawOut) / float64(wire)
+}
+
+// CompressedConn frames every write as [flag:1][length:4][payload] and
+// deflates frames that actually get smaller. Both ends of a tunnel connection
+// must wrap it after negotiating compression in the handshake.
+//
+// Already compressed content is skipped two ways: in HTTP mode the client
+// calls SetCompression from the response's Content-Type, while raw TCP
+// tunnels have no headers and rely only on the maxMisses heuristic.
+type CompressedConn struct {
+	net.Conn
+
+	wmu      sync.Mutex
+	writer   *flate.Writer // created on the first compressible write
+	wbuf     bytes.Buffer
+	disabled atomic.Bool
+	misses   int
+	skipped  int // frames sent raw without trying since maxMisses was hit
+
+	reader  io.ReadCloser
+	header  [frameHeaderSize]byte
+	payload []byte
+	pending []byte
+
+	rawIn, wireIn, rawOut, wireOut atomic.Int64
+}
+
+// NewCompressedConn wraps a negotiated tunnel connection. The deflate writer
+// (several hundred KB) is only allocated once something is worth compressing,
+// so idle pooled connections stay cheap.
+func NewCompressedConn(conn net.Conn) *CompressedConn {
+	return &CompressedConn{Conn: conn}
+}
+
+// SetCompression turns compression of outgoing frames on or off, e.g. off
+// for responses whose Content-Type is already compressed
+func (c *CompressedConn) SetCompression(enabled bool) {
+	c.wmu.Lock()
+	c.misses, c.skipped = 0, 0
+	c.wmu.Unlock()
+	c.disabled.Store(!enabled)
+}
+
+// Stats returns the byte counters of this connection
+func (c *CompressedConn) Stats() CompressionStats {
+	return CompressionStats{
+		RawIn:   c.rawIn.Load(),
+		WireIn:  c.wireIn.Load(),
+		RawOut:  c.rawOut.Load(),
+		WireOut: c.wireOut.Load(),
+	}
+}
+
+func (c *CompressedConn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), maxFrameSize)]
+		if err := c.writeFrame(chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+func (c *CompressedConn) writeFrame(chunk []byte) error {
+	flag, payload := frameRaw, chunk
+
+	if len(chunk) >= minCompressSize && !c.disabled.Load() && c.shouldTry() {
+		c.wbuf.Reset()
+		c.wbuf.Write(make([]byte, frameHeaderSize))
+		if c.writer == nil {
+			c.writer, _ = flate.NewWriter(&c.wbuf, flate.BestSpeed)
+		} else {
+			c.writer.Reset(&c.wbuf)
+		}
+		c.writer.Write(chunk)
+		if err := c.writer.Close(); err == nil && c.wbuf.Len()-frameHeaderSize < len(chunk) {
+			flag, payload = frameDeflate, c.wbuf.Bytes()[frameHeaderSize:]
+			c.misses = 0
+		} else {
+			c.misses++
+		}
+	}
+
+	var frame []byte
+	if flag == frameDeflate {
+		frame = c.wbuf.Bytes()
+	} else {
+		frame = make([]byte, frameHeaderSize+len(payload))
+		copy(frame[frameHeaderSize:], payload)
+	}
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:frameHeaderSize], uint32(len(payload)))
+
+	if _, err := c.Conn.Write(frame); err != nil {
+		return err
+	}
+	c.rawOut.Add(int64(len(chunk)))
+	c.wireOut.Add(int64(len(frame)))
+	return nil
+}
+
+// shouldTry reports whether the next frame is worth deflating: always until
+// maxMisses, then once per retryInterval frames (e.g. a raw TCP tunnel
+// that sends a zip file and then plain text)
+func (c *CompressedConn) shouldTry() bool {
+	if c.misses < maxMisses {
+		return true
+	}
+	c.skipped++
+	if c.skipped < retryInterval {
+		return false
+	}
+	c.skipped = 0
+	return true
+}
+
+func (c *CompressedConn) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		if err := c.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+func (c *CompressedConn) readFrame() error {
+	if _, err := io.ReadFull(c.Conn, c.header[:]); err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(c.header[1:])
+	if size > maxFrameSize+1024 {
+		return ErrFrameTooLarge
+	}
+
+	if cap(c.payload) < int(size) {
+		c.payload = make([]byte, size)
+	}
+	payload := c.payload[:size]
+	if _, err := io.ReadFull(c.Conn, payload); err != nil {
+		return err
+	}
+	c.wireIn.Add(int64(frameHeaderSize + size))
+
+	switch c.header[0] {
+	case frameRaw:
+		c.pending = payload
+	case frameDeflate:
+		if c.reader == nil {
+			c.reader = flate.NewReader(bytes.NewReader(payload))
+		} else {
+			c.reader.(flate.Resetter).Reset(bytes.NewReader(payload), nil)
+		}
+		decoded, err := io.ReadAll(io.LimitReader(c.reader, maxFrameSize+1))
+		if err != nil {
+			return err
+		}
+		if len(decoded) > maxFrameSize {
+			return ErrFrameTooLarge
+		}
+		c.pending = decoded
+	default:
+		return fmt.Errorf("unknown tunnel frame type %d", c.header[0])
+	}
+	c.rawIn.Add(int64(len(c.pending)))
+	return nil
+}
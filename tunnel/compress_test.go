@@ -0,0 +1,177 @@
+package tunnel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// frameRecorder is the wire under a CompressedConn: it keeps the flag of
+// every frame written
+type frameRecorder struct {
+	net.Conn
+	flags []byte
+}
+
+func (r *frameRecorder) Write(p []byte) (int, error) {
+	r.flags = append(r.flags, p[0])
+	return len(p), nil
+}
+
+func randomBytes(n int) []byte {
+	b := make([]byte, n)
+	rand.Read(b)
+	return b
+}
+
+func TestCompressedConnRoundTrip(t *testing.T) {
+	text := []byte(strings.Repeat("<li>compressible html</li>\n", 10000))
+	cases := []struct {
+		name string
+		data []byte
+	}{
+		{"one byte", []byte("x")},
+		{"below min size", text[:minCompressSize-1]},
+		{"min size", text[:minCompressSize]},
+		{"several frames", text},
+		{"exact frame", text[:maxFrameSize]},
+		{"incompressible", randomBytes(3*maxFrameSize + 17)},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			left, right := net.Pipe()
+			defer left.Close()
+			defer right.Close()
+			writer, reader := NewCompressedConn(left), NewCompressedConn(right)
+
+			errc := make(chan error, 1)
+			go func() {
+				_, err := writer.Write(c.data)
+				errc <- err
+			}()
+			got := make([]byte, len(c.data))
+			if _, err := io.ReadFull(reader, got); err != nil {
+				t.Fatal(err)
+			}
+			if err := <-errc; err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, c.data) {
+				t.Fatal("data changed in transit")
+			}
+
+			sent, received := writer.Stats(), reader.Stats()
+			if sent.RawOut != int64(len(c.data)) || received.RawIn != sent.RawOut || received.WireIn != sent.WireOut {
+				t.Errorf("stats don't add up: sent %+v, received %+v", sent, received)
+			}
+			if c.name == "several frames" && sent.WireOut*4 > sent.RawOut {
+				t.Errorf("text was not compressed: %d -> %d bytes", sent.RawOut, sent.WireOut)
+			}
+			if frames := (len(c.data) + maxFrameSize - 1) / maxFrameSize; sent.WireOut > int64(len(c.data)+frames*frameHeaderSize) {
+				t.Errorf("frames grew: %d -> %d bytes", sent.RawOut, sent.WireOut)
+			}
+		})
+	}
+}
+
+func TestCompressionFallback(t *testing.T) {
+	wire := &frameRecorder{}
+	conn := NewCompressedConn(wire)
+	text := []byte(strings.Repeat("plain text again ", 64))
+
+	write := func(data []byte, n int) string {
+		wire.flags = nil
+		for i := 0; i < n; i++ {
+			if _, err := conn.Write(data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var flags strings.Builder
+		for _, flag := range wire.flags {
+			flags.WriteByte('0' + flag)
+		}
+		return flags.String()
+	}
+
+	if got := write(text[:minCompressSize-1], 2); got != "00" {
+		t.Errorf("small writes: frames %s, want raw", got)
+	}
+	if got := write(text, 2); got != "11" {
+		t.Errorf("text: frames %s, want deflate", got)
+	}
+
+	// Incompressible data: tried maxMisses times, then sent raw untried
+	if got := write(randomBytes(1024), maxMisses+3); got != strings.Repeat("0", maxMisses+3) {
+		t.Errorf("random data: frames %s", got)
+	}
+	if conn.misses != maxMisses || conn.skipped != 3 {
+		t.Fatalf("misses = %d, skipped = %d after random data", conn.misses, conn.skipped)
+	}
+
+	// Text again: skipped until the next retry, which compresses and resets
+	want := strings.Repeat("0", retryInterval-4) + "11"
+	if got := write(text, retryInterval-2); got != want {
+		t.Errorf("text after random data: frames %s, want %s", got, want)
+	}
+	if conn.misses != 0 {
+		t.Errorf("misses = %d after a compressed frame", conn.misses)
+	}
+
+	conn.SetCompression(false)
+	if got := write(text, 2); got != "00" {
+		t.Errorf("compression off: frames %s, want raw", got)
+	}
+	conn.SetCompression(true)
+	if got := write(text, 1); got != "1" {
+		t.Errorf("compression back on: frames %s, want deflate", got)
+	}
+}
+
+func TestCompressedConnBadFrames(t *testing.T) {
+	frame := func(flag byte, size uint32, payload []byte) []byte {
+		b := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+		b[0] = flag
+		binary.BigEndian.PutUint32(b[1:], size)
+		return append(b, payload...)
+	}
+
+	cases := []struct {
+		name  string
+		frame []byte
+		check func(error) bool
+	}{
+		{"too large", frame(frameRaw, maxFrameSize+2048, nil), func(err error) bool {
+			return errors.Is(err, ErrFrameTooLarge)
+		}},
+		{"unknown type", frame(7, 3, []byte("abc")), func(err error) bool {
+			return err != nil && strings.Contains(err.Error(), "unknown tunnel frame type 7")
+		}},
+		{"not deflate", frame(frameDeflate, 3, []byte{0xff, 0xff, 0xff}), func(err error) bool {
+			return err != nil
+		}},
+		{"truncated", frame(frameRaw, 10, []byte("abc")), func(err error) bool {
+			return errors.Is(err, io.ErrUnexpectedEOF)
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			left, right := net.Pipe()
+			defer right.Close()
+			go func() {
+				left.Write(c.frame)
+				left.Close()
+			}()
+			_, err := NewCompressedConn(right).Read(make([]byte, 16))
+			if !c.check(err) {
+				t.Errorf("Read error = %v", err)
+			}
+		})
+	}
+}
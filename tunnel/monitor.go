@@ -0,0 +1,339 @@
+package tunnel
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxRecentErrors is how many errors the monitor keeps for the dashboard
+const maxRecentErrors = 50
+
+// Event is a single state change pushed to admin panel subscribers
+type Event struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// ClientInfo describes one connected tunnel client (grouped by remote host);
+// Connections counts its open tunnel connections, idle or carrying a stream
+type ClientInfo struct {
+	Addr        string    `json:"addr"`
+	Connections int       `json:"connections"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// StreamInfo describes one public connection currently piped through a tunnel
+type StreamInfo struct {
+	ID        int64     `json:"id"`
+	Remote    string    `json:"remote"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// ErrorInfo is a recent server-side error shown on the dashboard
+type ErrorInfo struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// Traffic is a per-second traffic sample used for the dashboard graphs
+type Traffic struct {
+	BytesIn       int64 `json:"bytes_in"`
+	BytesOut      int64 `json:"bytes_out"`
+	ActiveStreams int   `json:"active_streams"`
+}
+
+// Stats is a snapshot of the tunnel server state
+type Stats struct {
+	StartedAt     time.Time    `json:"started_at"`
+	Uptime        string       `json:"uptime"`
+	Clients       []ClientInfo `json:"clients"`
+	IdleTunnels   int          `json:"idle_tunnels"`
+	ActiveStreams []StreamInfo `json:"active_streams"`
+	TotalStreams  int64        `json:"total_streams"`
+	BytesIn       int64        `json:"bytes_in"`
+	BytesOut      int64        `json:"bytes_out"`
+	RecentErrors  []ErrorInfo  `json:"recent_errors"`
+	// Compression is the total of compressed tunnel connections
+	Compression      CompressionStats `json:"compression"`
+	CompressionRatio float64          `json:"compression_ratio"`
+}
+
+// Monitor collects live tunnel server state and fans it out to subscribers
+type Monitor struct {
+	mu          sync.Mutex
+	startedAt   time.Time
+	clients     map[string]*ClientInfo
+	idle        int
+	streams     map[int64]StreamInfo
+	total       int64
+	bytesIn     int64
+	bytesOut    int64
+	lastIn      int64
+	lastOut     int64
+	errors      []ErrorInfo
+	compression CompressionStats
+	subscribers map[chan Event]struct{}
+}
+
+// NewMonitor creates a monitor and starts its traffic sampler
+func NewMonitor() *Monitor {
+	m := &Monitor{
+		startedAt:   time.Now(),
+		clients:     make(map[string]*ClientInfo),
+		streams:     make(map[int64]StreamInfo),
+		subscribers: make(map[chan Event]struct{}),
+	}
+	go m.sampleTraffic()
+	return m
+}
+
+// ClientConnected records a new tunnel connection from a client; it starts
+// out idle in the pool
+func (m *Monitor) ClientConnected(addr net.Addr) {
+	host := hostOf(addr)
+
+	m.mu.Lock()
+	m.idle++
+	client, ok := m.clients[host]
+	if !ok {
+		client = &ClientInfo{Addr: host, ConnectedAt: time.Now()}
+		m.clients[host] = client
+	}
+	client.Connections++
+	info := *client
+	m.mu.Unlock()
+
+	if !ok {
+		m.publish("client_connected", info)
+	}
+}
+
+// TunnelTaken records that an idle tunnel connection left the pool, to carry
+// a stream or because the client hung up; the client stays connected until
+// its connection closes
+func (m *Monitor) TunnelTaken() {
+	m.mu.Lock()
+	if m.idle > 0 {
+		m.idle--
+	}
+	m.mu.Unlock()
+}
+
+// ClientDisconnected records that a tunnel connection of a client closed;
+// the client is gone when its last connection is
+func (m *Monitor) ClientDisconnected(addr net.Addr) {
+	host := hostOf(addr)
+
+	m.mu.Lock()
+	client, ok := m.clients[host]
+	gone := false
+	if ok {
+		client.Connections--
+		if client.Connections <= 0 {
+			delete(m.clients, host)
+			gone = true
+		}
+	}
+	m.mu.Unlock()
+
+	if gone {
+		m.publish("client_disconnected", ClientInfo{Addr: host})
+	}
+}
+
+// StreamOpened records a public connection paired with a tunnel
+func (m *Monitor) StreamOpened(id int64, remote net.Addr) {
+	info := StreamInfo{ID: id, Remote: remote.String(), StartedAt: time.Now()}
+
+	m.mu.Lock()
+	m.streams[id] = info
+	m.total++
+	m.mu.Unlock()
+
+	m.publish("stream_opened", info)
+}
+
+// StreamClosed records the end of a stream and the bytes it moved
+func (m *Monitor) StreamClosed(id int64, bytesIn, bytesOut int64) {
+	m.mu.Lock()
+	delete(m.streams, id)
+	m.mu.Unlock()
+
+	m.publish("stream_closed", map[string]int64{
+		"id":        id,
+		"bytes_in":  bytesIn,
+		"bytes_out": bytesOut,
+	})
+}
+
+// AddTraffic adds transferred bytes to the counters (in = public -> local)
+func (m *Monitor) AddTraffic(bytesIn, bytesOut int64) {
+	m.mu.Lock()
+	m.bytesIn += bytesIn
+	m.bytesOut += bytesOut
+	m.mu.Unlock()
+}
+
+// AddCompression adds the counters of a finished compressed stream
+func (m *Monitor) AddCompression(stats CompressionStats) {
+	m.mu.Lock()
+	m.compression.RawIn += stats.RawIn
+	m.compression.WireIn += stats.WireIn
+	m.compression.RawOut += stats.RawOut
+	m.compression.WireOut += stats.WireOut
+	m.mu.Unlock()
+}
+
+// Error records a server-side error
+func (m *Monitor) Error(format string, args ...interface{}) {
+	info := ErrorInfo{Time: time.Now(), Message: fmt.Sprintf(format, args...)}
+
+	m.mu.Lock()
+	m.errors = append(m.errors, info)
+	if len(m.errors) > maxRecentErrors {
+		m.errors = m.errors[len(m.errors)-maxRecentErrors:]
+	}
+	m.mu.Unlock()
+
+	m.publish("error", info)
+}
+
+// Snapshot returns the current state
+func (m *Monitor) Snapshot() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := Stats{
+		StartedAt:     m.startedAt,
+		Uptime:        time.Since(m.startedAt).Round(time.Second).String(),
+		Clients:       make([]ClientInfo, 0, len(m.clients)),
+		IdleTunnels:   m.idle,
+		ActiveStreams: make([]StreamInfo, 0, len(m.streams)),
+		TotalStreams:  m.total,
+		BytesIn:       m.bytesIn,
+		BytesOut:      m.bytesOut,
+		RecentErrors:  append([]ErrorInfo{}, m.errors...),
+		Compression:   m.compression,
+	}
+	stats.CompressionRatio = m.compression.Ratio()
+	for _, c := range m.clients {
+		stats.Clients = append(stats.Clients, *c)
+	}
+	for _, s := range m.streams {
+		stats.ActiveStreams = append(stats.ActiveStreams, s)
+	}
+	sort.Slice(stats.Clients, func(i, j int) bool { return stats.Clients[i].Addr < stats.Clients[j].Addr })
+	sort.Slice(stats.ActiveStreams, func(i, j int) bool { return stats.ActiveStreams[i].ID < stats.ActiveStreams[j].ID })
+	return stats
+}
+
+// Subscribe returns a channel of events; call the returned func to unsubscribe.
+// Slow subscribers miss events instead of blocking the tunnel.
+func (m *Monitor) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 64)
+
+	m.mu.Lock()
+	m.subscribers[ch] = struct{}{}
+	m.mu.Unlock()
+
+	return ch, func() {
+		m.mu.Lock()
+		delete(m.subscribers, ch)
+		m.mu.Unlock()
+	}
+}
+
+// Handler serves the monitor over HTTP:
+//
+//	GET /stats   current snapshot as JSON
+//	GET /events  server-sent events stream
+func (m *Monitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stats", m.serveStats)
+	mux.HandleFunc("GET /events", m.serveEvents)
+	return mux
+}
+
+func (m *Monitor) serveStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(m.Snapshot())
+}
+
+func (m *Monitor) serveEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	events, unsubscribe := m.Subscribe()
+	defer unsubscribe()
+
+	writeEvent(w, Event{Type: "snapshot", Time: time.Now(), Data: m.Snapshot()})
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			writeEvent(w, event)
+			flusher.Flush()
+		}
+	}
+}
+
+// sampleTraffic publishes a traffic event every second for the graphs
+func (m *Monitor) sampleTraffic() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.mu.Lock()
+		sample := Traffic{
+			BytesIn:       m.bytesIn - m.lastIn,
+			BytesOut:      m.bytesOut - m.lastOut,
+			ActiveStreams: len(m.streams),
+		}
+		m.lastIn, m.lastOut = m.bytesIn, m.bytesOut
+		m.mu.Unlock()
+
+		m.publish("traffic", sample)
+	}
+}
+
+func (m *Monitor) publish(eventType string, data interface{}) {
+	event := Event{Type: eventType, Time: time.Now(), Data: data}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for ch := range m.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event Event) {
+	data, _ := json.Marshal(event)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
+
+func hostOf(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	return host
+}
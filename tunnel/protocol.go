@@ -0,0 +1,171 @@
+package tunnel
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Hello is the first message a client sends on every tunnel connection.
+// Messages are newline-delimited JSON, like the TCP API in tcp_server.go.
+type Hello struct {
+	// Version is the protocol version the client speaks, 0 for version 1
+	// clients that predate versioning
+	Version int `json:"version,omitempty"`
+	// Features lists the optional features the client supports
+	Features []string `json:"features,omitempty"`
+	// ClientVersion is the client binary version, for logs
+	ClientVersion string `json:"client_version,omitempty"`
+	// Name is the requested tunnel name (alice -> alice.<tunnel-domain>),
+	// empty for the default (anonymous) tunnel
+	Name string `json:"name,omitempty"`
+	// Token is the user's API token, needed for reserved names
+	Token string `json:"token,omitempty"`
+	// Session is a random ID the client sends on all pooled connections of
+	// one tunnel; the server binds a live name to the first session using it
+	Session string `json:"session,omitempty"`
+	// Compression lists the algorithms the client accepts, in preference order
+	Compression []string `json:"compression,omitempty"`
+}
+
+// HelloResult is the server's answer to Hello
+type HelloResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// Code classifies a rejection (CodeIncompatible, CodeUnauthorized)
+	Code string `json:"code,omitempty"`
+	// Version is the protocol version chosen by the server, 0 for servers
+	// that predate versioning (version 1)
+	Version int `json:"version,omitempty"`
+	// Features are the features enabled for this connection
+	Features []string `json:"features,omitempty"`
+	// ServerVersion is the server binary version
+	ServerVersion string `json:"server_version,omitempty"`
+	// Compression is the algorithm chosen for this connection, empty for none
+	Compression string `json:"compression,omitempty"`
+	// Registration tells the client where the tunnel is reachable
+	Registration *Registration `json:"registration,omitempty"`
+}
+
+// Registration is what the server assigned to a tunnel
+type Registration struct {
+	Tunnel string `json:"tunnel,omitempty"`
+	// URLs are the public addresses of the tunnel, the first one is the primary
+	URLs []string `json:"urls"`
+	// Ports are the public TCP ports the server accepts traffic on
+	Ports         []int  `json:"ports,omitempty"`
+	Limits        Limits `json:"limits"`
+	ServerVersion string `json:"server_version,omitempty"`
+}
+
+// Limits are the server-side limits applied to a tunnel
+type Limits struct {
+	// MaxIdle is how many pooled connections the server keeps per tunnel,
+	// connections above it are closed
+	MaxIdle int `json:"max_idle"`
+}
+
+// ErrRejected is returned by Handshake when the server refuses the tunnel
+var ErrRejected = errors.New("tunnel rejected by server")
+
+// ErrNoHelloResult is returned by Handshake when the server does not answer
+// within HandshakeTimeout, which is how v1 servers (no Hello at all) behave.
+// The hello line is already in that server's pool then, so the caller must
+// drop the connection and dial again without a Hello.
+var ErrNoHelloResult = errors.New("server did not answer hello (protocol v1 server)")
+
+// HandshakeTimeout is how long Handshake waits for the HelloResult
+const HandshakeTimeout = 5 * time.Second
+
+// WriteMessage writes v as a single JSON line
+func WriteMessage(w io.Writer, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// ReadMessage reads a single JSON line into v
+func ReadMessage(r *bufio.Reader, v interface{}) error {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(line, v)
+}
+
+// Handshake sends hello over conn and waits up to HandshakeTimeout for the
+// server's answer.
+// The returned conn must be used afterwards, it keeps any buffered bytes
+// and applies the negotiated compression.
+func Handshake(conn net.Conn, hello Hello) (net.Conn, *HelloResult, error) {
+	if err := WriteMessage(conn, hello); err != nil {
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	var result HelloResult
+	conn.SetReadDeadline(time.Now().Add(HandshakeTimeout))
+	err := ReadMessage(reader, &result)
+	conn.SetReadDeadline(time.Time{})
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() && reader.Buffered() == 0 {
+		return nil, nil, ErrNoHelloResult
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case !result.OK && result.Code == CodeIncompatible:
+		return nil, &result, fmt.Errorf("%w: %s", ErrIncompatible, result.Error)
+	case !result.OK:
+		return nil, &result, ErrRejected
+	}
+	if result.Version != 0 && result.Version < MinProtocolVersion {
+		return nil, &result, fmt.Errorf("%w: server v%d, client v%d..v%d", ErrIncompatible, result.Version, MinProtocolVersion, ProtocolVersion)
+	}
+	return Wrap(NewBufferedConn(conn, reader), result.Compression), &result, nil
+}
+
+// Wrap applies the negotiated compression to a tunnel connection
+func Wrap(conn net.Conn, compression string) net.Conn {
+	if compression == CompressionDeflate {
+		return NewCompressedConn(conn)
+	}
+	return conn
+}
+
+// BufferedConn is a net.Conn whose reads go through a bufio.Reader, so bytes
+// already buffered while parsing (handshake, Host peeking) are not lost
+type BufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// NewBufferedConn wraps conn so reads drain reader first
+func NewBufferedConn(conn net.Conn, reader *bufio.Reader) *BufferedConn {
+	return &BufferedConn{Conn: conn, reader: reader}
+}
+
+func (c *BufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// Peek waits for the next n bytes without consuming them
+func (c *BufferedConn) Peek(n int) ([]byte, error) {
+	return c.reader.Peek(n)
+}
+
+// Forward is the first message on a node-to-node connection in cluster mode:
+// the receiving node pipes the rest of the connection into its tunnel Name
+type Forward struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret,omitempty"`
+	Remote string `json:"remote,omitempty"`
+}
@@ -0,0 +1,96 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Protocol versions:
+//
+//	1 - Hello without a version field (or no Hello at all, raw legacy clients)
+//	2 - versioned Hello with feature negotiation
+//
+// A server accepts clients from MinProtocolVersion up to ProtocolVersion and
+// answers newer clients with its own version, so both sides can run one
+// release apart (N-1) in either direction.
+const (
+	ProtocolVersion    = 2
+	MinProtocolVersion = 1
+)
+
+// Features that can be negotiated in Hello
+const (
+	// FeatureCompression enables the Compression list in Hello
+	FeatureCompression = "compression"
+	// FeatureRegistration makes the server send Registration in HelloResult
+	FeatureRegistration = "registration"
+)
+
+// Features is everything this build supports, in the order it is offered
+var Features = []string{FeatureCompression, FeatureRegistration}
+
+// legacyFeatures are implied for version 1 clients, which predate the list
+var legacyFeatures = []string{FeatureCompression, FeatureRegistration}
+
+// Rejection codes in HelloResult.Code
+const (
+	CodeIncompatible = "incompatible_version"
+	CodeUnauthorized = "unauthorized"
+	// CodeNameUnavailable means another client holds the name, or the
+	// server has no domain to route names with
+	CodeNameUnavailable = "name_unavailable"
+)
+
+// ErrIncompatible is returned by Handshake when the server speaks a protocol
+// version this client no longer supports
+var ErrIncompatible = errors.New("incompatible tunnel protocol version")
+
+// ProtocolVersion returns the version the client speaks, 1 for clients that
+// did not send one
+func (h Hello) ProtocolVersion() int {
+	if h.Version == 0 {
+		return 1
+	}
+	return h.Version
+}
+
+// OfferedFeatures returns the features the client asked for
+func (h Hello) OfferedFeatures() []string {
+	if h.Version == 0 {
+		return legacyFeatures
+	}
+	return h.Features
+}
+
+// NegotiateVersion picks the version used with a client speaking offered;
+// min is the oldest version the server still accepts
+func NegotiateVersion(offered, min int) (int, error) {
+	if offered < min {
+		return 0, fmt.Errorf("client protokoli v%d eskirgan, server v%d..v%d ni qo'llaydi: clientni yangilang", offered, min, ProtocolVersion)
+	}
+	if offered > ProtocolVersion {
+		return ProtocolVersion, nil
+	}
+	return offered, nil
+}
+
+// NegotiateFeatures keeps the offered features this build supports
+func NegotiateFeatures(offered []string) []string {
+	var accepted []string
+	for _, feature := range offered {
+		if HasFeature(Features, feature) {
+			accepted = append(accepted, feature)
+		}
+	}
+	return accepted
+}
+
+// HasFeature reports whether feature is in features
+func HasFeature(features []string, feature string) bool {
+	for _, f := range features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
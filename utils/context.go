@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"go-tunnel/models"
+)
+
+// contextKey - request context kalitlari boshqa paketlar bilan to'qnashmasligi uchun
+type contextKey string
+
+const (
+	paramsKey    contextKey = "route-params"
+	requestIDKey contextKey = "request-id"
+	userKey      contextKey = "user"
+	authTokenKey contextKey = "auth-token"
+)
+
+// WithParams route parametrlarini ({id}, {path...}) request context'iga qo'shadi
+func WithParams(r *http.Request, params map[string]string) *http.Request {
+	for name, value := range params {
+		r.SetPathValue(name, value)
+	}
+	return r.WithContext(context.WithValue(r.Context(), paramsKey, params))
+}
+
+// Params barcha route parametrlarini qaytaradi (nil bo'lishi mumkin)
+func Params(r *http.Request) map[string]string {
+	params, _ := r.Context().Value(paramsKey).(map[string]string)
+	return params
+}
+
+// Param route parametri: /api/users/{id} uchun Param(r, "id")
+func Param(r *http.Request, name string) string {
+	return Params(r)[name]
+}
+
+// ParamInt butun son parametri ({id:int} uchun)
+func ParamInt(r *http.Request, name string) (int64, error) {
+	return strconv.ParseInt(Param(r, name), 10, 64)
+}
+
+// WithRequestID so'rov ID'sini context'ga qo'shadi (middleware.RequestID)
+func WithRequestID(r *http.Request, id string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey, id))
+}
+
+// RequestID so'rov ID'si, middleware.RequestID ishlamagan bo'lsa bo'sh
+func RequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey).(string)
+	return id
+}
+
+// WithUser autentifikatsiya qilingan foydalanuvchini context'ga qo'shadi
+// (middleware.CheckAuth)
+func WithUser(r *http.Request, user *models.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userKey, user))
+}
+
+// User context'dagi foydalanuvchi, CheckAuth'siz route'larda nil
+func User(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userKey).(*models.User)
+	return user
+}
+
+// UserID context'dagi foydalanuvchi ID'si; ok=false bo'lsa foydalanuvchi yo'q
+func UserID(r *http.Request) (uint, bool) {
+	if user := User(r); user != nil {
+		return user.ID, true
+	}
+	return 0, false
+}
+
+// WithAuthToken so'rov qaysi token bilan autentifikatsiya qilinganini
+// context'ga qo'shadi (logout shu token sessiyasini bekor qiladi)
+func WithAuthToken(r *http.Request, token *models.AuthToken) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), authTokenKey, token))
+}
+
+// AuthToken context'dagi auth_tokens yozuvi, CheckAuth'siz route'larda nil
+func AuthToken(r *http.Request) *models.AuthToken {
+	token, _ := r.Context().Value(authTokenKey).(*models.AuthToken)
+	return token
+}
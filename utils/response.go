@@ -22,7 +22,13 @@ func GenerateRandomString(n int) string {
 
 
 func SendResponse(w http.ResponseWriter, success bool, message string, data interface{}) {
+    SendStatusResponse(w, http.StatusOK, success, message, data)
+}
+
+// SendStatusResponse is SendResponse with an HTTP status other than 200
+func SendStatusResponse(w http.ResponseWriter, status int, success bool, message string, data interface{}) {
     w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
     resp := models.Response{
         Success: success,
         Message: message,